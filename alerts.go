@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// LatestAlert is the last alert of one type sent for a site, kept in the
+// site's alerts_latest collection under the alert type.
+type LatestAlert struct {
+	Type     string `json:"type" firestore:"type"`
+	Severity string `json:"severity" firestore:"severity"`
+	Ambient
+	Timestamp time.Time `json:"timestamp" firestore:"timestamp,serverTimestamp"`
+}
+
+// recordAlert stores the alert as the latest of its type for the site. It
+// doesn't affect delivery, so a failed write is only logged, and a server
+// without Firestore records nothing.
+func (s *Server) recordAlert(ctx context.Context, alert string, ambient Ambient) {
+
+	if s.fs == nil {
+		return
+	}
+
+	defer observeFirestore("recordAlert", time.Now())
+
+	doc := s.collection(ambient.SiteID, s.cfg.Collections.AlertsLatest).Doc(alert)
+	latest := LatestAlert{Type: alert, Severity: s.cfg.severity(ambient), Ambient: ambient}
+
+	err := s.retry(ctx, func() (err error) {
+		_, err = doc.Set(ctx, latest)
+		return
+	})
+
+	if err != nil {
+		slog.Error("record alert", "op", "recordAlert", "collection", s.cfg.Collections.AlertsLatest, "site", ambient.SiteID, "alert", alert, "err", err)
+	}
+
+}
+
+// getLatestAlerts answers GET /alerts/latest?site= with the last alert of
+// each type sent for the site, keyed by type. Types never alerted on are
+// left out.
+func (s *Server) getLatestAlerts(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	site, ok := siteParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	var docs []*firestore.DocumentSnapshot
+
+	err := s.retry(ctx, func() (err error) {
+		docs, err = s.collection(site, s.cfg.Collections.AlertsLatest).Documents(ctx).GetAll()
+		return
+	})
+
+	if err != nil {
+		slog.Error("read latest alerts", "op", "getLatestAlerts", "collection", s.cfg.Collections.AlertsLatest, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	alerts := map[string]LatestAlert{}
+
+	for _, doc := range docs {
+
+		latest := LatestAlert{}
+
+		if err := doc.DataTo(&latest); err != nil {
+			slog.Warn("skip malformed alert doc", "op", "getLatestAlerts", "doc", doc.Ref.ID, "err", err)
+			continue
+		}
+
+		alerts[doc.Ref.ID] = latest
+
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"site":   site,
+		"alerts": alerts,
+	})
+
+}
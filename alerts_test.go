@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLatestAlerts(t *testing.T) {
+
+	s := newTestServer(t)
+	s.cfg.TempMax = 30
+
+	latest := s.collection("alerts-site", s.cfg.Collections.AlertsLatest)
+	clearCollection(t, latest)
+	t.Cleanup(func() { clearCollection(t, latest) })
+
+	ctx := context.Background()
+	s.recordAlert(ctx, alertTemperature, Ambient{SiteID: "alerts-site", Temperature: 31})
+	s.recordAlert(ctx, alertTemperature, Ambient{SiteID: "alerts-site", Temperature: 36})
+	s.recordAlert(ctx, alertMovement, Ambient{SiteID: "alerts-site", Temperature: 22, Movement: 1})
+
+	w := httptest.NewRecorder()
+	s.getLatestAlerts(w, httptest.NewRequest("GET", "/alerts/latest?site=alerts-site", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var body struct {
+		Alerts map[string]LatestAlert `json:"alerts"`
+	}
+
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	temperature, ok := body.Alerts[alertTemperature]
+
+	if !ok || temperature.Temperature != 36 || temperature.Severity != severityCritical || temperature.Timestamp.IsZero() {
+		t.Errorf("temperature alert = %+v, want the latest critical one with a timestamp", temperature)
+	}
+
+	if movement, ok := body.Alerts[alertMovement]; !ok || movement.Movement != 1 {
+		t.Errorf("movement alert = %+v, want it recorded", movement)
+	}
+
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// validSiteID checks that a site identifier can be used as a Firestore
+// document ID.
+func validSiteID(site string) error {
+
+	if site == "" {
+		return fmt.Errorf("siteId is required")
+	}
+
+	if strings.Contains(site, "/") || site == "." || site == ".." {
+		return fmt.Errorf("invalid siteId %q", site)
+	}
+
+	return nil
+
+}
+
+// defaultSensor is the sensorId of readings that don't send one, from
+// firmware predating multiple sensors per site.
+const defaultSensor = "default"
+
+// validSensorID checks that a sensor identifier can be used as a Firestore
+// document ID. An empty one stands for the default sensor.
+func validSensorID(sensor string) error {
+
+	if strings.Contains(sensor, "/") || sensor == "." || sensor == ".." {
+		return fmt.Errorf("invalid sensorId %q", sensor)
+	}
+
+	return nil
+
+}
+
+// source names where the reading came from in alerts: the site, followed by
+// the sensor unless it is the default one.
+func (a Ambient) source() string {
+
+	return sourceName(a.SiteID, a.SensorID)
+
+}
+
+// sourceName joins a site and sensor as alerts show them.
+func sourceName(site, sensor string) string {
+
+	if sensor == "" || sensor == defaultSensor {
+		return site
+	}
+
+	return site + "/" + sensor
+
+}
+
+// validate checks that every reading is within the range the sensor can
+// physically report. The heat index and dew point are derived on the server
+// and can legitimately go past the sensor's range, so they are not checked.
+func (a Ambient) validate() error {
+
+	if err := validSiteID(a.SiteID); err != nil {
+		return err
+	}
+
+	if err := validSensorID(a.SensorID); err != nil {
+		return err
+	}
+
+	if a.Temperature < -40 || a.Temperature > 85 {
+		return fmt.Errorf("temperature %.2f out of range [-40, 85]", a.Temperature)
+	}
+
+	if a.Humidity < 0 || a.Humidity > 100 {
+		return fmt.Errorf("humidity %.2f out of range [0, 100]", a.Humidity)
+	}
+
+	if a.Movement < 0 {
+		return fmt.Errorf("movement %d must not be negative", a.Movement)
+	}
+
+	return nil
+
+}
+
+// computeHeatIndex returns the heat index in °C using the NOAA Rothfusz
+// regression, falling back to Steadman's simple formula for mild conditions
+// where the regression is not valid.
+func computeHeatIndex(tempC, humidity float64) float64 {
+
+	t := tempC*9/5 + 32
+	rh := humidity
+
+	hi := 0.5 * (t + 61.0 + (t-68.0)*1.2 + rh*0.094)
+
+	if (hi+t)/2 >= 80 {
+
+		hi = -42.379 + 2.04901523*t + 10.14333127*rh -
+			0.22475541*t*rh - 0.00683783*t*t -
+			0.05481717*rh*rh + 0.00122874*t*t*rh +
+			0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+
+		if rh < 13 && t >= 80 && t <= 112 {
+			hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+		} else if rh > 85 && t >= 80 && t <= 87 {
+			hi += (rh - 85) / 10 * (87 - t) / 5
+		}
+
+	}
+
+	return (hi - 32) * 5 / 9
+
+}
+
+// The heat index regression only applies from about 27°C (80°F) and 40%
+// relative humidity; below that it is close to the air temperature.
+const (
+	heatIndexMinTemp     = 26.7
+	heatIndexMinHumidity = 40
+)
+
+// heatIndexApplies reports whether the heat index is meaningful for the
+// reading.
+func heatIndexApplies(tempC, humidity float64) bool {
+
+	return tempC >= heatIndexMinTemp && humidity >= heatIndexMinHumidity
+
+}
+
+// formatTemperature renders a Celsius value in the given unit ("C" or "F").
+func formatTemperature(celsius float64, unit string) string {
+
+	if unit == "F" {
+		return fmt.Sprintf("%.2f°F", celsius*9/5+32)
+	}
+
+	return fmt.Sprintf("%.2f°C", celsius)
+
+}
+
+// computeDewPoint returns the dew point in °C using the Magnus formula with
+// the Sonntag (1990) constants. Humidity is floored at 1% since the formula
+// is undefined at 0%.
+func computeDewPoint(tempC, humidity float64) float64 {
+
+	const a, b = 17.62, 243.12
+
+	rh := math.Max(humidity, 1)
+	gamma := math.Log(rh/100) + a*tempC/(b+tempC)
+
+	return b * gamma / (a - gamma)
+
+}
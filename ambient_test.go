@@ -0,0 +1,135 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAmbientValidate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		ambient Ambient
+		wantErr bool
+	}{
+		{"valid", Ambient{SiteID: "room-1", Temperature: 24, Humidity: 50, HeatIndex: 25}, false},
+		{"valid movement", Ambient{SiteID: "room-1", Temperature: 24, Humidity: 50, HeatIndex: 25, Movement: 1}, false},
+		{"bounds", Ambient{SiteID: "room-1", Temperature: 85, Humidity: 100, HeatIndex: computeHeatIndex(85, 100)}, false},
+		{"hot room", Ambient{SiteID: "room-1", Temperature: 55, Humidity: 40, HeatIndex: computeHeatIndex(55, 40)}, false},
+		{"lower bounds", Ambient{SiteID: "room-1", Temperature: -40, Humidity: 0, HeatIndex: -40}, false},
+		{"temperature too low", Ambient{SiteID: "room-1", Temperature: -9999, Humidity: 50, HeatIndex: 25}, true},
+		{"temperature too high", Ambient{SiteID: "room-1", Temperature: 86, Humidity: 50, HeatIndex: 25}, true},
+		{"negative humidity", Ambient{SiteID: "room-1", Temperature: 24, Humidity: -1, HeatIndex: 25}, true},
+		{"humidity too high", Ambient{SiteID: "room-1", Temperature: 24, Humidity: 101, HeatIndex: 25}, true},
+		{"missing site", Ambient{Temperature: 24, Humidity: 50, HeatIndex: 25}, true},
+		{"invalid site", Ambient{SiteID: "a/b", Temperature: 24, Humidity: 50, HeatIndex: 25}, true},
+		{"negative movement", Ambient{SiteID: "room-1", Temperature: 24, Humidity: 50, HeatIndex: 25, Movement: -1}, true},
+		{"sensor", Ambient{SiteID: "room-1", SensorID: "rack-2", Temperature: 24, Humidity: 50, HeatIndex: 25}, false},
+		{"invalid sensor", Ambient{SiteID: "room-1", SensorID: "rack/2", Temperature: 24, Humidity: 50, HeatIndex: 25}, true},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			err := tt.ambient.validate()
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+		})
+
+	}
+
+}
+
+func TestAmbientSource(t *testing.T) {
+
+	if got := (Ambient{SiteID: "room-1", SensorID: defaultSensor}).source(); got != "room-1" {
+		t.Errorf("default sensor source = %q, want room-1", got)
+	}
+
+	if got := (Ambient{SiteID: "room-1", SensorID: "rack-2"}).source(); got != "room-1/rack-2" {
+		t.Errorf("sensor source = %q, want room-1/rack-2", got)
+	}
+
+}
+
+func TestComputeHeatIndex(t *testing.T) {
+
+	fahrenheit := func(f float64) float64 { return (f - 32) * 5 / 9 }
+
+	// Reference values from the NWS heat index chart.
+	tests := []struct {
+		tempF, humidity, want float64
+	}{
+		{70, 50, 69.1},
+		{80, 40, 79.9},
+		{90, 50, 94.6},
+		{90, 70, 105.9},
+		{100, 40, 109.2},
+		{86, 90, 104.8},
+		{104, 10, 98.8},
+	}
+
+	for _, tt := range tests {
+
+		got := computeHeatIndex(fahrenheit(tt.tempF), tt.humidity)
+
+		if want := fahrenheit(tt.want); math.Abs(got-want) > 0.5 {
+			t.Errorf("computeHeatIndex(%.0fF, %.0f%%) = %.2f°C, want %.2f°C", tt.tempF, tt.humidity, got, want)
+		}
+
+	}
+
+}
+
+func TestFormatTemperature(t *testing.T) {
+
+	tests := []struct {
+		celsius float64
+		unit    string
+		want    string
+	}{
+		{25, "C", "25.00°C"},
+		{25, "F", "77.00°F"},
+		{-40, "F", "-40.00°F"},
+		{37.5, "F", "99.50°F"},
+	}
+
+	for _, tt := range tests {
+
+		if got := formatTemperature(tt.celsius, tt.unit); got != tt.want {
+			t.Errorf("formatTemperature(%v, %q) = %q, want %q", tt.celsius, tt.unit, got, tt.want)
+		}
+
+	}
+
+}
+
+func TestComputeDewPoint(t *testing.T) {
+
+	tests := []struct {
+		tempC, humidity, want float64
+	}{
+		{20, 50, 9.26},
+		{25, 60, 16.69},
+		{30, 80, 26.17},
+		{10, 100, 10},
+		{0, 50, -9.2},
+	}
+
+	for _, tt := range tests {
+
+		if got := computeDewPoint(tt.tempC, tt.humidity); math.Abs(got-tt.want) > 0.1 {
+			t.Errorf("computeDewPoint(%v, %v) = %.2f, want %.2f", tt.tempC, tt.humidity, got, tt.want)
+		}
+
+	}
+
+	if got := computeDewPoint(25, 0); math.IsNaN(got) || math.IsInf(got, 0) {
+		t.Errorf("computeDewPoint(25, 0) = %v, want a finite value", got)
+	}
+
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/messaging"
+)
+
+// apnsConfig returns the FCM options for iOS devices: an aps alert mirroring
+// the title and body of the data message, grouped per site. Only info alerts
+// go out at the power-saving priority 5, and the style's TTL becomes the
+// apns-expiration. bundleID, from APNS_BUNDLE_ID, is sent as apns-topic when
+// set.
+func apnsConfig(data map[string]string, style androidStyle, bundleID string) *messaging.APNSConfig {
+
+	headers := map[string]string{
+		"apns-priority":  "10",
+		"apns-push-type": "alert",
+	}
+
+	if data["Severity"] == severityInfo {
+		headers["apns-priority"] = "5"
+	}
+
+	if bundleID != "" {
+		headers["apns-topic"] = bundleID
+	}
+
+	if style.TTL > 0 {
+		headers["apns-expiration"] = strconv.FormatInt(time.Now().Add(style.TTL).Unix(), 10)
+	}
+
+	return &messaging.APNSConfig{
+		Headers: headers,
+		Payload: &messaging.APNSPayload{
+			Aps: &messaging.Aps{
+				Alert: &messaging.ApsAlert{
+					Title: data["Title"],
+					Body:  strings.ReplaceAll(data["Body"], "<br>", "\n"),
+				},
+				Sound:    style.Sound,
+				Category: data["type"],
+				ThreadID: data["Site"],
+			},
+		},
+	}
+
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAPNSConfig(t *testing.T) {
+
+	data := map[string]string{
+		"Title":    "[room-1] Alerta",
+		"Body":     "Temperatura: 35°C<br>Humedad: 40%",
+		"Site":     "room-1",
+		"Severity": severityCritical,
+		"type":     typeAmbient,
+	}
+
+	apns := apnsConfig(data, androidStyle{Sound: "default", TTL: time.Hour}, "com.example.monitor")
+
+	if apns.Headers["apns-priority"] != "10" || apns.Headers["apns-topic"] != "com.example.monitor" {
+		t.Errorf("headers = %v, want priority 10 and the bundle topic", apns.Headers)
+	}
+
+	aps := apns.Payload.Aps
+
+	if aps.Alert.Title != data["Title"] || aps.Alert.Body != "Temperatura: 35°C\nHumedad: 40%" {
+		t.Errorf("alert = %+v, want the title and newline-separated body", aps.Alert)
+	}
+
+	if aps.Sound != "default" || aps.ThreadID != "room-1" || aps.Category != typeAmbient {
+		t.Errorf("aps = %+v, want sound default grouped by site", aps)
+	}
+
+	data["Severity"] = severityInfo
+
+	if expires, err := strconv.ParseInt(apns.Headers["apns-expiration"], 10, 64); err != nil || expires < time.Now().Add(59*time.Minute).Unix() {
+		t.Errorf("apns-expiration = %q, want an hour from now", apns.Headers["apns-expiration"])
+	}
+
+	apns = apnsConfig(data, androidStyle{}, "")
+
+	if apns.Headers["apns-priority"] != "5" || apns.Headers["apns-topic"] != "" || apns.Headers["apns-expiration"] != "" {
+		t.Errorf("info headers = %v, want priority 5 and no topic or expiration", apns.Headers)
+	}
+
+}
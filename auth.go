@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAPIKey rejects requests that don't carry the configured API key in
+// either the X-API-Key header or an "Authorization: Bearer" header. When no
+// API_KEY is configured every request is let through.
+func (s *Server) requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if s.cfg.APIKey == "" {
+			next(w, r)
+			return
+		}
+
+		key := r.Header.Get("X-API-Key")
+
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); key == "" && ok {
+			key = bearer
+		}
+
+		if subtle.ConstantTimeCompare([]byte(key), []byte(s.cfg.APIKey)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Unauthorized"))
+			return
+		}
+
+		next(w, r)
+
+	}
+
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+
+	s := &Server{cfg: Config{APIKey: "secret"}}
+	handler := s.requireAPIKey(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"missing", "", "", http.StatusUnauthorized},
+		{"wrong key", "X-API-Key", "nope", http.StatusUnauthorized},
+		{"api key header", "X-API-Key", "secret", http.StatusOK},
+		{"bearer", "Authorization", "Bearer secret", http.StatusOK},
+		{"wrong bearer", "Authorization", "Bearer nope", http.StatusUnauthorized},
+		{"no bearer prefix", "Authorization", "secret", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+
+		r := httptest.NewRequest("POST", "/sendAll", nil)
+
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+
+	}
+
+}
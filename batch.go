@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ItemResult reports what happened to one reading of a batch.
+type ItemResult struct {
+	Index  int    `json:"index"`
+	Stored bool   `json:"stored"`
+	Moved  bool   `json:"moved,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// AlertResult reports the alert coalesced from a batch for one alert type.
+type AlertResult struct {
+	Index  int    `json:"index"`
+	Sent   int    `json:"sent"`
+	Failed int    `json:"failed"`
+	Status string `json:"status,omitempty"`
+}
+
+// BatchResult is the response to an array posted to /sendAll.
+type BatchResult struct {
+	Items  []ItemResult           `json:"items"`
+	Alerts map[string]AlertResult `json:"alerts"`
+	DryRun bool                   `json:"dryRun,omitempty"`
+}
+
+var severityRank = map[string]int{severityInfo: 0, severityWarning: 1, severityCritical: 2}
+
+// sendBatch ingests an array of readings. Every valid reading is stored and
+// every movement logged, but the batch sends at most one alert per type: the
+// first logged movement and the most severe reading past the thresholds,
+// the latest one on ties.
+func (s *Server) sendBatch(w http.ResponseWriter, r *http.Request, body []byte) {
+
+	var raw []json.RawMessage
+
+	if err := json.Unmarshal(body, &raw); err != nil {
+		slog.Error("decode ambient batch", "op", "sendAll", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	readings := make([]Ambient, len(raw))
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	batch := BatchResult{Items: make([]ItemResult, len(raw)), Alerts: map[string]AlertResult{}, DryRun: s.cfg.DryRun}
+	candidates := map[string]int{}
+	heartbeats := map[string]bool{}
+
+	for i := range readings {
+
+		ambient := &readings[i]
+		item := &batch.Items[i]
+		item.Index = i
+
+		decoded, err := decodeAmbient(raw[i])
+
+		if err != nil {
+			item.Error = err.Error()
+			continue
+		}
+
+		s.readings.add(decoded, time.Now())
+		*ambient = decoded
+
+		ambient.HeatIndex = computeHeatIndex(ambient.Temperature, ambient.Humidity)
+		ambient.DewPoint = computeDewPoint(ambient.Temperature, ambient.Humidity)
+
+		if err := ambient.validate(); err != nil {
+			item.Error = err.Error()
+			continue
+		}
+
+		if !heartbeats[ambient.SiteID] {
+			s.heartbeat(ctx, ambient.SiteID)
+			heartbeats[ambient.SiteID] = true
+		}
+
+		if err := s.writeAmbient(ctx, *ambient); err != nil {
+			slog.Error("write ambient", "op", "sendAll", "collection", s.cfg.Collections.Ambient, "index", i, "err", err)
+		} else {
+			item.Stored = true
+		}
+
+		if ambient.Movement > 0 {
+
+			now := time.Now()
+
+			if s.debounceMovement(ambient.SiteID, now) {
+				continue
+			}
+
+			s.logMovement(ctx, ambient.SiteID, now)
+			item.Moved = true
+
+			if _, ok := candidates[alertMovement]; !ok && !s.cfg.stale(*ambient, now) {
+				candidates[alertMovement] = i
+			}
+
+			continue
+
+		}
+
+		s.humidity.observe(*ambient, s.cfg)
+
+		if !s.exceedsThresholds(*ambient) || s.cfg.stale(*ambient, time.Now()) {
+			continue
+		}
+
+		best, ok := candidates[alertTemperature]
+
+		if !ok || severityRank[s.cfg.severity(*ambient)] >= severityRank[s.cfg.severity(readings[best])] {
+			candidates[alertTemperature] = i
+		}
+
+	}
+
+	for alert, i := range candidates {
+
+		result, err := s.sendAlert(ctx, readings[i])
+		alertResult := AlertResult{Index: i, Sent: result.Sent, Failed: result.Failed}
+
+		switch {
+		case errors.Is(err, errCooldown):
+			alertResult.Status = "cooldown"
+		case errors.Is(err, errQuietHours):
+			alertResult.Status = "quiet"
+		case errors.Is(err, errMessagingUnavailable):
+			alertResult.Status = "unavailable"
+		case err != nil:
+			slog.Error("send push notification", "op", "sendAll", "alert", alert, "err", err)
+			alertResult.Status = "failed"
+		}
+
+		batch.Alerts[alert] = alertResult
+
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batch)
+
+}
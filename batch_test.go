@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSendAllBatch(t *testing.T) {
+
+	s := newTestServer(t)
+	fcm := &fakeNotifier{}
+	s.fcm = fcm
+	s.cfg.TempMax = 30
+	s.cfg.HeatIndexMax = 40
+	s.cfg.HumidityMax = 70
+	s.cfg.UseTopic = true
+	s.cfg.TopicName = "alerts"
+
+	for _, name := range []string{s.cfg.Collections.Ambient, s.cfg.Collections.Movement} {
+		collection := s.collection("test-site", name)
+		clearCollection(t, collection)
+		t.Cleanup(func() { clearCollection(t, collection) })
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(s.sendAll))
+	defer srv.Close()
+
+	body := ` [
+		{"siteId":"test-site","temperature":33,"humidity":40},
+		{"siteId":"test-site","temperature":40,"humidity":40},
+		{"siteId":"test-site","temperature":31,"humidity":40},
+		{"siteId":"test-site","temperature":500,"humidity":40},
+		{"siteId":"test-site","temperature":24,"humidity":40,"move":1},
+		{"siteId":"test-site","temperature":24,"humidity":40,"move":1}
+	]`
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var batch BatchResult
+
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batch.Items) != 6 || batch.Items[3].Error == "" || batch.Items[3].Stored || !batch.Items[0].Stored {
+		t.Errorf("items = %+v", batch.Items)
+	}
+
+	if !batch.Items[4].Moved || !batch.Items[5].Moved {
+		t.Errorf("both movements should be logged: %+v", batch.Items[4:])
+	}
+
+	// One alert per type: the critical 40°C reading and the first movement.
+	if a := batch.Alerts[alertTemperature]; a.Index != 1 || a.Sent != 1 {
+		t.Errorf("temperature alert = %+v, want index 1 sent", a)
+	}
+
+	if a := batch.Alerts[alertMovement]; a.Index != 4 || a.Sent != 1 {
+		t.Errorf("movement alert = %+v, want index 4 sent", a)
+	}
+
+	if len(fcm.sent) != 2 {
+		t.Errorf("sent %d pushes, want 2", len(fcm.sent))
+	}
+
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// errCircuitOpen is returned by broadcast while the FCM breaker is open. It
+// wraps errMessagingUnavailable so callers treat it the same way.
+var errCircuitOpen = fmt.Errorf("%w: circuit open", errMessagingUnavailable)
+
+// breaker is a circuit breaker around the FCM calls. It opens after failures
+// consecutive errors, rejects sends for cooldown and then lets a single
+// probe through per cooldown: the probe closes it on success and reopens it
+// on failure. A nil *breaker lets everything through.
+type breaker struct {
+	failures int
+	cooldown time.Duration
+
+	mu       sync.Mutex
+	count    int
+	openedAt time.Time
+}
+
+func newBreaker(failures int, cooldown time.Duration) *breaker {
+
+	return &breaker{failures: failures, cooldown: cooldown}
+
+}
+
+// allow reports whether a send may go ahead.
+func (b *breaker) allow(now time.Time) bool {
+
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.count < b.failures {
+		return true
+	}
+
+	if now.Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+
+	// Restarting the cooldown holds back other sends while the probe runs,
+	// and allows a new probe should this one never record a result.
+	b.openedAt = now
+	return true
+
+}
+
+// record counts the outcome of an FCM call.
+func (b *breaker) record(err error, now time.Time) {
+
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasOpen := b.count >= b.failures
+
+	if err == nil {
+
+		if wasOpen {
+			slog.Info("fcm circuit closed")
+		}
+
+		b.count = 0
+		return
+
+	}
+
+	b.count++
+
+	if b.count >= b.failures {
+
+		if !wasOpen {
+			slog.Warn("fcm circuit open, skipping notifications", "failures", b.count, "cooldown", b.cooldown.String())
+		}
+
+		b.openedAt = now
+
+	}
+
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+
+	b := newBreaker(2, time.Minute)
+	now := time.Now()
+	fail := errors.New("unavailable")
+
+	b.record(fail, now)
+
+	if !b.allow(now) {
+		t.Fatal("open after one failure")
+	}
+
+	b.record(fail, now)
+
+	if b.allow(now.Add(30 * time.Second)) {
+		t.Fatal("closed during cooldown")
+	}
+
+	probe := now.Add(time.Minute)
+
+	if !b.allow(probe) {
+		t.Fatal("no probe after cooldown")
+	}
+
+	if b.allow(probe) {
+		t.Error("second probe let through while the first is pending")
+	}
+
+	b.record(fail, probe)
+
+	if b.allow(probe.Add(30 * time.Second)) {
+		t.Error("closed after a failed probe")
+	}
+
+	recovered := probe.Add(time.Minute)
+
+	if !b.allow(recovered) {
+		t.Fatal("no probe after second cooldown")
+	}
+
+	b.record(nil, recovered)
+
+	if !b.allow(recovered) || !b.allow(recovered) {
+		t.Error("still open after a successful probe")
+	}
+
+}
+
+func TestBroadcastCircuitOpen(t *testing.T) {
+
+	fcm := &fakeNotifier{err: errors.New("unavailable")}
+	s := &Server{cfg: Config{UseTopic: true, TopicName: "alerts"}, fcm: fcm, breaker: newBreaker(2, time.Minute)}
+
+	for i := 0; i < 3; i++ {
+		s.broadcast(context.Background(), "room-1", alertTemperature, map[string]string{"Title": "t"})
+	}
+
+	if len(fcm.sent) != 2 {
+		t.Errorf("%d sends attempted, want 2 before the circuit opens", len(fcm.sent))
+	}
+
+	_, err := s.broadcast(context.Background(), "room-1", alertTemperature, map[string]string{"Title": "t"})
+
+	if !errors.Is(err, errCircuitOpen) || !errors.Is(err, errMessagingUnavailable) {
+		t.Errorf("broadcast() error = %v, want errCircuitOpen", err)
+	}
+
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ComputeRequest is the body of POST /compute. Both readings are required.
+type ComputeRequest struct {
+	Temperature *float64 `json:"temperature"`
+	Humidity    *float64 `json:"humidity"`
+}
+
+// compute returns the heat index and dew point for a temperature and
+// humidity pair, for checking sensor firmware against the server. It needs
+// neither Firestore nor FCM.
+func (s *Server) compute(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	req := ComputeRequest{}
+
+	if err := s.decodeJSON(w, r, &req); err != nil {
+
+		if isTooLarge(err) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write([]byte("Body too large"))
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Missing data"))
+		return
+
+	}
+
+	if req.Temperature == nil || req.Humidity == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("temperature and humidity are required"))
+		return
+	}
+
+	// validate only needs a site to check the readings.
+	ambient := Ambient{SiteID: "compute", Temperature: *req.Temperature, Humidity: *req.Humidity}
+
+	if err := ambient.validate(); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]float64{
+		"heatIndex": computeHeatIndex(ambient.Temperature, ambient.Humidity),
+		"dewPoint":  computeDewPoint(ambient.Temperature, ambient.Humidity),
+	})
+
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+
+	s := &Server{cfg: Config{MaxBodyBytes: 1 << 10}}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"valid", "POST", `{"temperature":32,"humidity":70}`, http.StatusOK},
+		{"missing humidity", "POST", `{"temperature":32}`, http.StatusBadRequest},
+		{"bad json", "POST", `{`, http.StatusBadRequest},
+		{"out of range", "POST", `{"temperature":120,"humidity":70}`, http.StatusUnprocessableEntity},
+		{"wrong method", "GET", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+
+		w := httptest.NewRecorder()
+		s.compute(w, httptest.NewRequest(tt.method, "/compute", strings.NewReader(tt.body)))
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+			continue
+		}
+
+		if tt.want != http.StatusOK {
+			continue
+		}
+
+		var got map[string]float64
+
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got["heatIndex"] != computeHeatIndex(32, 70) || got["dewPoint"] != computeDewPoint(32, 70) {
+			t.Errorf("%s: got %v", tt.name, got)
+		}
+
+	}
+
+}
@@ -0,0 +1,781 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Collections holds the Firestore collection names used by the service.
+type Collections struct {
+	Sites        string
+	Movement     string
+	Tokens       string
+	Temperatures string
+	Ambient      string
+
+	TemperatureDaily string
+	Sensors          string
+	AlertsLatest     string
+}
+
+// Config holds the settings read from the environment at startup.
+type Config struct {
+	TempMax      float64
+	HeatIndexMax float64
+	HumidityMax  float64
+	HumidityMin  float64
+	Cooldown     time.Duration
+
+	// A humidity alert that fired is re-armed once humidity is back inside
+	// its band by HumidityHysteresis percentage points; 0 disables this.
+	HumidityHysteresis float64
+
+	ShutdownGrace time.Duration
+	Location      *time.Location
+
+	UseTopic  bool
+	TopicName string
+
+	// DryRun logs push notifications instead of sending them; the other
+	// channels are not affected.
+	DryRun bool
+
+	// DebugEndpoints serves /debug/readings, the last DebugReadings
+	// ambient payloads received.
+	DebugEndpoints bool
+	DebugReadings  int
+
+	MaxBodyBytes      int64
+	FirestoreTimeout  time.Duration
+	FirestoreAttempts int
+
+	BreakerFailures int
+	BreakerCooldown time.Duration
+
+	TempUnit     string
+	TempDecimals int
+
+	// HeatIndexDisplay says how alerts show a heat index outside the range
+	// it is meaningful in: omitted, as N/A, or always shown.
+	HeatIndexDisplay string
+
+	TempEMAAlpha float64
+	Locale       string
+	TimeFormat   string
+
+	// A reading more than TempSpikeDelta away from the previous hour is
+	// flagged or dropped per TempSpikeMode; 0 disables the check.
+	TempSpikeDelta float64
+	TempSpikeMode  string
+
+	// A reading climbing faster than TempRiseRate °C per minute since the
+	// last one raises a "rising rapidly" alert; 0 disables it.
+	TempRiseRate float64
+
+	// MaxConcurrentSends bounds how many multicast batches of one
+	// notification are in flight at once.
+	MaxConcurrentSends int
+
+	// AndroidStyles is keyed by the notification type.
+	AndroidStyles map[string]androidStyle
+	APNSBundleID  string
+
+	// The icon and image are passed to the app as data keys. With
+	// NotificationBlock, messages also carry an FCM notification block, so
+	// the OS shows them without the app; see notificationBlock.
+	NotificationIconURL  string
+	NotificationImageURL string
+	NotificationBlock    bool
+
+	// Templates holds the optional title and body templates; nil keeps the
+	// message catalog.
+	Templates *template.Template
+
+	Collections   Collections
+	TokensPerSite bool
+
+	// TokenCacheMaxAge is how old a cached token list may be and still be
+	// used when reading the tokens fails; 0 disables the cache.
+	TokenCacheMaxAge time.Duration
+
+	MaxReadingAge time.Duration
+
+	// QuietStart and QuietEnd are offsets from midnight in Location; the
+	// window may wrap past midnight and is off when they are equal.
+	QuietStart time.Duration
+	QuietEnd   time.Duration
+
+	MovementDebounce  time.Duration
+	MovementRetention int
+	MovementPageMax   int
+
+	AmbientRetention int
+
+	SensorStale time.Duration
+
+	APIKey string
+
+	CORSAllowOrigin string
+
+	// RateLimit is the sustained readings per second allowed per client IP
+	// on the ingest endpoints, 0 to disable. TrustProxy takes the client IP
+	// from the last X-Forwarded-For entry, the one the proxy appended.
+	RateLimit  float64
+	RateBurst  int
+	TrustProxy bool
+
+	IdempotencyTTL time.Duration
+	IdempotencyMax int
+
+	StreamMax int
+
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// WebhookTimeout bounds every outbound webhook, Slack included.
+	WebhookURL      string
+	WebhookTimeout  time.Duration
+	SlackWebhookURL string
+
+	SMTPHost string
+	SMTPPort int
+	SMTPUser string
+	SMTPPass string
+	SMTPFrom string
+	EmailTo  []string
+}
+
+// Email reports whether email alerts are configured.
+func (c Config) Email() bool {
+
+	return c.SMTPHost != "" && len(c.EmailTo) > 0
+
+}
+
+// TLS reports whether the server should serve HTTPS itself.
+func (c Config) TLS() bool {
+
+	return c.TLSCertFile != ""
+
+}
+
+func loadConfig() (cfg Config, err error) {
+
+	if cfg.TempMax, err = envFloat("ALERT_TEMP_MAX", 30.0); err != nil {
+		return
+	}
+
+	if cfg.HeatIndexMax, err = envFloat("ALERT_HEATINDEX_MAX", 40.0); err != nil {
+		return
+	}
+
+	if cfg.HumidityMax, err = envFloat("ALERT_HUMIDITY_MAX", 70.0); err != nil {
+		return
+	}
+
+	// The default of 0 leaves the low-humidity alert off.
+	if cfg.HumidityMin, err = envFloat("ALERT_HUMIDITY_MIN", 0.0); err != nil {
+		return
+	}
+
+	if cfg.HumidityMin > cfg.HumidityMax {
+		return cfg, fmt.Errorf("ALERT_HUMIDITY_MIN %.1f is above ALERT_HUMIDITY_MAX %.1f", cfg.HumidityMin, cfg.HumidityMax)
+	}
+
+	if cfg.HumidityHysteresis, err = envFloat("HUMIDITY_HYSTERESIS", 0); err != nil {
+		return
+	}
+
+	if cfg.HumidityHysteresis < 0 {
+		return cfg, fmt.Errorf("invalid HUMIDITY_HYSTERESIS %v: must not be negative", cfg.HumidityHysteresis)
+	}
+
+	if cfg.Cooldown, err = envSeconds("ALERT_COOLDOWN_SECONDS", 300); err != nil {
+		return
+	}
+
+	if cfg.ShutdownGrace, err = envSeconds("SHUTDOWN_GRACE_SECONDS", 15); err != nil {
+		return
+	}
+
+	cfg.Location = loadLocation(os.Getenv("TZ_LOCATION"))
+
+	if cfg.UseTopic, err = envBool("FCM_USE_TOPIC", false); err != nil {
+		return
+	}
+
+	if cfg.DryRun, err = envBool("DRY_RUN", false); err != nil {
+		return
+	}
+
+	if cfg.DebugEndpoints, err = envBool("DEBUG_ENDPOINTS", false); err != nil {
+		return
+	}
+
+	if cfg.DebugReadings, err = envInt("DEBUG_READINGS", 100); err != nil {
+		return
+	}
+
+	if cfg.DebugReadings < 1 {
+		return cfg, fmt.Errorf("invalid DEBUG_READINGS %d: must be at least 1", cfg.DebugReadings)
+	}
+
+	cfg.TopicName = os.Getenv("FCM_TOPIC_NAME")
+
+	if cfg.UseTopic && cfg.TopicName == "" {
+		return cfg, fmt.Errorf("FCM_TOPIC_NAME is required when FCM_USE_TOPIC is set")
+	}
+
+	maxBody, err := envInt("MAX_BODY_BYTES", 64<<10)
+
+	if err != nil {
+		return
+	}
+
+	cfg.MaxBodyBytes = int64(maxBody)
+
+	cfg.Collections = loadCollections()
+
+	if cfg.TokensPerSite, err = envBool("TOKENS_PER_SITE", false); err != nil {
+		return
+	}
+
+	if cfg.TokenCacheMaxAge, err = envDuration("TOKEN_CACHE_MAX_AGE", time.Hour); err != nil {
+		return
+	}
+
+	if cfg.TokenCacheMaxAge < 0 {
+		return cfg, fmt.Errorf("invalid TOKEN_CACHE_MAX_AGE %v: must not be negative", cfg.TokenCacheMaxAge)
+	}
+
+	if cfg.MaxReadingAge, err = envDuration("MAX_READING_AGE", 5*time.Minute); err != nil {
+		return
+	}
+
+	if cfg.QuietStart, err = envClock("QUIET_HOURS_START"); err != nil {
+		return
+	}
+
+	if cfg.QuietEnd, err = envClock("QUIET_HOURS_END"); err != nil {
+		return
+	}
+
+	if cfg.MovementDebounce, err = envSeconds("MOVEMENT_DEBOUNCE_SECONDS", 10); err != nil {
+		return
+	}
+
+	if cfg.MovementRetention, err = envInt("MOVEMENT_RETENTION_DAYS", 7); err != nil {
+		return
+	}
+
+	if cfg.MovementRetention < 1 {
+		return cfg, fmt.Errorf("invalid MOVEMENT_RETENTION_DAYS %d: must be at least 1", cfg.MovementRetention)
+	}
+
+	if cfg.MovementPageMax, err = envInt("MOVEMENT_PAGE_MAX", 31); err != nil {
+		return
+	}
+
+	if cfg.MovementPageMax < cfg.MovementRetention {
+		return cfg, fmt.Errorf("MOVEMENT_PAGE_MAX %d is below MOVEMENT_RETENTION_DAYS %d", cfg.MovementPageMax, cfg.MovementRetention)
+	}
+
+	if cfg.AmbientRetention, err = envInt("AMBIENT_RETENTION_DAYS", 30); err != nil {
+		return
+	}
+
+	if cfg.AmbientRetention < 1 {
+		return cfg, fmt.Errorf("invalid AMBIENT_RETENTION_DAYS %d: must be at least 1", cfg.AmbientRetention)
+	}
+
+	staleMinutes, err := envInt("SENSOR_STALE_MINUTES", 15)
+
+	if err != nil {
+		return
+	}
+
+	cfg.SensorStale = time.Duration(staleMinutes) * time.Minute
+
+	cfg.APIKey = os.Getenv("API_KEY")
+	cfg.CORSAllowOrigin = envString("CORS_ALLOW_ORIGIN", "*")
+
+	if cfg.StreamMax, err = envInt("STREAM_MAX_CLIENTS", 20); err != nil {
+		return
+	}
+
+	if cfg.StreamMax < 1 {
+		return cfg, fmt.Errorf("invalid STREAM_MAX_CLIENTS %d: must be at least 1", cfg.StreamMax)
+	}
+
+	if cfg.RateLimit, err = envFloat("RATE_LIMIT_PER_SECOND", 1); err != nil {
+		return
+	}
+
+	if cfg.RateBurst, err = envInt("RATE_LIMIT_BURST", 10); err != nil {
+		return
+	}
+
+	if cfg.RateLimit < 0 || (cfg.RateLimit > 0 && cfg.RateBurst < 1) {
+		return cfg, fmt.Errorf("invalid rate limit %v/s with burst %d", cfg.RateLimit, cfg.RateBurst)
+	}
+
+	if cfg.TrustProxy, err = envBool("TRUST_PROXY", false); err != nil {
+		return
+	}
+
+	if cfg.IdempotencyTTL, err = envSeconds("IDEMPOTENCY_TTL_SECONDS", 600); err != nil {
+		return
+	}
+
+	if cfg.IdempotencyMax, err = envInt("IDEMPOTENCY_MAX_KEYS", 1000); err != nil {
+		return
+	}
+
+	if cfg.IdempotencyMax < 1 {
+		return cfg, fmt.Errorf("invalid IDEMPOTENCY_MAX_KEYS %d: must be at least 1", cfg.IdempotencyMax)
+	}
+
+	if cfg.FirestoreTimeout, err = envDuration("FIRESTORE_TIMEOUT", 10*time.Second); err != nil {
+		return
+	}
+
+	if cfg.FirestoreAttempts, err = envInt("FIRESTORE_MAX_ATTEMPTS", 3); err != nil {
+		return
+	}
+
+	if cfg.BreakerFailures, err = envInt("FCM_BREAKER_FAILURES", 5); err != nil {
+		return
+	}
+
+	if cfg.BreakerCooldown, err = envSeconds("FCM_BREAKER_COOLDOWN_SECONDS", 30); err != nil {
+		return
+	}
+
+	cfg.WebhookURL = os.Getenv("WEBHOOK_URL")
+	cfg.SlackWebhookURL = os.Getenv("SLACK_WEBHOOK_URL")
+
+	cfg.SMTPHost = os.Getenv("SMTP_HOST")
+
+	if cfg.SMTPPort, err = envInt("SMTP_PORT", 587); err != nil {
+		return
+	}
+
+	cfg.SMTPUser = os.Getenv("SMTP_USER")
+	cfg.SMTPPass = os.Getenv("SMTP_PASS")
+	cfg.SMTPFrom = envString("SMTP_FROM", cfg.SMTPUser)
+
+	for _, to := range strings.Split(os.Getenv("ALERT_EMAIL_TO"), ",") {
+
+		if to = strings.TrimSpace(to); to != "" {
+			cfg.EmailTo = append(cfg.EmailTo, to)
+		}
+
+	}
+
+	if cfg.Email() && cfg.SMTPFrom == "" {
+		return cfg, fmt.Errorf("SMTP_FROM or SMTP_USER is required for email alerts")
+	}
+
+	if cfg.WebhookTimeout, err = envDuration("WEBHOOK_TIMEOUT", 5*time.Second); err != nil {
+		return
+	}
+
+	if cfg.TLSCertFile, cfg.TLSKeyFile, err = loadTLSFiles(); err != nil {
+		return
+	}
+
+	cfg.TimeFormat = strings.ToLower(envString("TIME_FORMAT", clock12h))
+
+	if cfg.TimeFormat != clock12h && cfg.TimeFormat != clock24h {
+		return cfg, fmt.Errorf("invalid TIME_FORMAT %q: must be 12h or 24h", cfg.TimeFormat)
+	}
+
+	cfg.TempUnit = strings.ToUpper(envString("TEMP_UNIT", "C"))
+
+	if cfg.TempUnit != "C" && cfg.TempUnit != "F" {
+		return cfg, fmt.Errorf("invalid TEMP_UNIT %q: must be C or F", cfg.TempUnit)
+	}
+
+	cfg.HeatIndexDisplay = strings.ToLower(envString("HEAT_INDEX_DISPLAY", heatIndexOmit))
+
+	switch cfg.HeatIndexDisplay {
+	case heatIndexOmit, heatIndexNA, heatIndexAlways:
+	default:
+		return cfg, fmt.Errorf("invalid HEAT_INDEX_DISPLAY %q: must be omit, na or always", cfg.HeatIndexDisplay)
+	}
+
+	if cfg.TempDecimals, err = envInt("TEMP_DECIMALS", 2); err != nil {
+		return
+	}
+
+	if cfg.TempDecimals < 0 || cfg.TempDecimals > 6 {
+		return cfg, fmt.Errorf("invalid TEMP_DECIMALS %d: must be between 0 and 6", cfg.TempDecimals)
+	}
+
+	if cfg.TempEMAAlpha, err = envFloat("TEMP_EMA_ALPHA", 0); err != nil {
+		return
+	}
+
+	if cfg.TempEMAAlpha < 0 || cfg.TempEMAAlpha > 1 {
+		return cfg, fmt.Errorf("invalid TEMP_EMA_ALPHA %v: must be between 0 and 1", cfg.TempEMAAlpha)
+	}
+
+	if cfg.TempSpikeDelta, err = envFloat("TEMP_SPIKE_DELTA", 10); err != nil {
+		return
+	}
+
+	if cfg.TempSpikeDelta < 0 {
+		return cfg, fmt.Errorf("invalid TEMP_SPIKE_DELTA %v: must not be negative", cfg.TempSpikeDelta)
+	}
+
+	cfg.TempSpikeMode = strings.ToLower(envString("TEMP_SPIKE_MODE", spikeFlag))
+
+	if cfg.TempSpikeMode != spikeFlag && cfg.TempSpikeMode != spikeDrop {
+		return cfg, fmt.Errorf("invalid TEMP_SPIKE_MODE %q: must be flag or drop", cfg.TempSpikeMode)
+	}
+
+	if cfg.TempRiseRate, err = envFloat("TEMP_RISE_RATE", 0); err != nil {
+		return
+	}
+
+	if cfg.TempRiseRate < 0 {
+		return cfg, fmt.Errorf("invalid TEMP_RISE_RATE %v: must not be negative", cfg.TempRiseRate)
+	}
+
+	if cfg.MaxConcurrentSends, err = envInt("MAX_CONCURRENT_SENDS", 4); err != nil {
+		return
+	}
+
+	if cfg.MaxConcurrentSends < 1 {
+		return cfg, fmt.Errorf("invalid MAX_CONCURRENT_SENDS %d: must be at least 1", cfg.MaxConcurrentSends)
+	}
+
+	cfg.Locale = strings.ToLower(envString("NOTIFICATION_LOCALE", "es"))
+
+	if _, ok := messages[cfg.Locale]; !ok {
+		return cfg, fmt.Errorf("unsupported NOTIFICATION_LOCALE %q", cfg.Locale)
+	}
+
+	if cfg.Templates, err = loadTemplates(cfg.TempUnit); err != nil {
+		return
+	}
+
+	if cfg.AndroidStyles, err = loadAndroidStyles(); err != nil {
+		return
+	}
+	cfg.APNSBundleID = os.Getenv("APNS_BUNDLE_ID")
+	cfg.NotificationIconURL = os.Getenv("NOTIFICATION_ICON_URL")
+	cfg.NotificationImageURL = os.Getenv("NOTIFICATION_IMAGE_URL")
+
+	if cfg.NotificationBlock, err = envBool("NOTIFICATION_BLOCK", false); err != nil {
+		return
+	}
+
+	return
+
+}
+
+// loadTLSFiles reads TLS_CERT_FILE and TLS_KEY_FILE, which must be set
+// together and name readable files.
+func loadTLSFiles() (cert, key string, err error) {
+
+	cert = os.Getenv("TLS_CERT_FILE")
+	key = os.Getenv("TLS_KEY_FILE")
+
+	if cert == "" && key == "" {
+		return
+	}
+
+	if cert == "" || key == "" {
+		return "", "", fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	for name, path := range map[string]string{"TLS_CERT_FILE": cert, "TLS_KEY_FILE": key} {
+
+		if _, err = os.Stat(path); err != nil {
+			return "", "", fmt.Errorf("invalid %s: %w", name, err)
+		}
+
+	}
+
+	return
+
+}
+
+// loadCollections reads the collection names, each overridable on its own.
+// COLLECTION_PREFIX (e.g. "staging_") applies to the top-level collections;
+// the per-site subcollections live under the already prefixed sites
+// collection.
+func loadCollections() Collections {
+
+	prefix := os.Getenv("COLLECTION_PREFIX")
+
+	return Collections{
+		Sites:        prefix + envString("COLLECTION_SITES", "sites"),
+		Movement:     envString("COLLECTION_MOVEMENT", "movement"),
+		Tokens:       prefix + envString("COLLECTION_TOKENS", "tokens"),
+		Temperatures: envString("COLLECTION_TEMPERATURES", "temperatures"),
+		Ambient:      envString("COLLECTION_AMBIENT", "ambient"),
+
+		TemperatureDaily: envString("COLLECTION_TEMPERATURE_DAILY", "temperature_daily"),
+		Sensors:          prefix + envString("COLLECTION_SENSORS", "sensors"),
+		AlertsLatest:     envString("COLLECTION_ALERTS_LATEST", "alerts_latest"),
+	}
+
+}
+
+func envString(key, def string) string {
+
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return def
+
+}
+
+func envFloat(key string, def float64) (float64, error) {
+
+	value := os.Getenv(key)
+
+	if value == "" {
+		return def, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return f, nil
+
+}
+
+func envInt(key string, def int) (int, error) {
+
+	value := os.Getenv(key)
+
+	if value == "" {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(value)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return i, nil
+
+}
+
+func envBool(key string, def bool) (bool, error) {
+
+	value := os.Getenv(key)
+
+	if value == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return b, nil
+
+}
+
+func envSeconds(key string, def int) (time.Duration, error) {
+
+	seconds, err := envInt(key, def)
+	return time.Duration(seconds) * time.Second, err
+
+}
+
+// envClock parses an HH:MM time of day into its offset from midnight; unset
+// is midnight.
+func envClock(key string) (time.Duration, error) {
+
+	value := os.Getenv(key)
+
+	if value == "" {
+		return 0, nil
+	}
+
+	t, err := time.Parse("15:04", value)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: want HH:MM", key, value)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+
+}
+
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+
+	value := os.Getenv(key)
+
+	if value == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(value)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return d, nil
+
+}
+
+// loadLocation loads the IANA time zone name, falling back to the fixed
+// default zone when it's empty or unknown.
+func loadLocation(name string) *time.Location {
+
+	if name == "" {
+		return defaultTimeZone
+	}
+
+	loc, err := time.LoadLocation(name)
+
+	if err != nil {
+		slog.Warn("load TZ_LOCATION, using default", "location", name, "err", err)
+		return defaultTimeZone
+	}
+
+	return loc
+
+}
+
+// effective returns the configuration as served by GET /config. Secrets
+// (the API key, the SMTP credentials and the webhook URLs, which embed
+// tokens) are only reported as set or not.
+func (c Config) effective() map[string]interface{} {
+
+	return map[string]interface{}{
+		"timezone": c.Location.String(),
+		"thresholds": map[string]interface{}{
+			"tempMax":      c.TempMax,
+			"heatIndexMax": c.HeatIndexMax,
+			"humidityMax":  c.HumidityMax,
+			"humidityMin":  c.HumidityMin,
+			"hysteresis":   c.HumidityHysteresis,
+		},
+		"cooldown":          c.Cooldown.String(),
+		"maxReadingAge":     c.MaxReadingAge.String(),
+		"quietHours":        []string{c.QuietStart.String(), c.QuietEnd.String()},
+		"shutdownGrace":     c.ShutdownGrace.String(),
+		"useTopic":          c.UseTopic,
+		"topicName":         c.TopicName,
+		"concurrentSends":   c.MaxConcurrentSends,
+		"dryRun":            c.DryRun,
+		"maxBodyBytes":      c.MaxBodyBytes,
+		"firestoreTimeout":  c.FirestoreTimeout.String(),
+		"firestoreAttempts": c.FirestoreAttempts,
+		"tempUnit":          c.TempUnit,
+		"tempDecimals":      c.TempDecimals,
+		"heatIndexDisplay":  c.HeatIndexDisplay,
+		"tempEmaAlpha":      c.TempEMAAlpha,
+		"tempSpikeDelta":    c.TempSpikeDelta,
+		"tempSpikeMode":     c.TempSpikeMode,
+		"tempRiseRate":      c.TempRiseRate,
+		"locale":            c.Locale,
+		"timeFormat":        c.TimeFormat,
+		"templates":         c.Templates != nil,
+		"androidStyles":     c.effectiveStyles(),
+		"apnsBundleId":      c.APNSBundleID,
+		"collections":       c.Collections,
+		"tokensPerSite":     c.TokensPerSite,
+		"tokenCacheMaxAge":  c.TokenCacheMaxAge.String(),
+		"movement": map[string]interface{}{
+			"debounce":      c.MovementDebounce.String(),
+			"retentionDays": c.MovementRetention,
+			"pageMax":       c.MovementPageMax,
+		},
+		"fcmBreaker": map[string]interface{}{
+			"failures": c.BreakerFailures,
+			"cooldown": c.BreakerCooldown.String(),
+		},
+		"ambient": map[string]interface{}{
+			"retentionDays": c.AmbientRetention,
+		},
+		"idempotency": map[string]interface{}{
+			"ttl":     c.IdempotencyTTL.String(),
+			"maxKeys": c.IdempotencyMax,
+		},
+		"rateLimit": map[string]interface{}{
+			"perSecond":  c.RateLimit,
+			"burst":      c.RateBurst,
+			"trustProxy": c.TrustProxy,
+		},
+		"notification": map[string]interface{}{
+			"iconUrl":  c.NotificationIconURL,
+			"imageUrl": c.NotificationImageURL,
+			"block":    c.NotificationBlock,
+		},
+		"debug": map[string]interface{}{
+			"endpoints": c.DebugEndpoints,
+			"readings":  c.DebugReadings,
+		},
+		"sensorStale":     c.SensorStale.String(),
+		"apiKey":          c.APIKey != "",
+		"corsAllowOrigin": c.CORSAllowOrigin,
+		"streamMax":       c.StreamMax,
+		"tls":             c.TLS(),
+		"webhook":         c.WebhookURL != "",
+		"webhookTimeout":  c.WebhookTimeout.String(),
+		"slack":           c.SlackWebhookURL != "",
+		"email": map[string]interface{}{
+			"enabled": c.Email(),
+			"host":    c.SMTPHost,
+			"port":    c.SMTPPort,
+			"to":      c.EmailTo,
+		},
+	}
+
+}
+
+// effectiveStyles renders AndroidStyles for /config.
+func (c Config) effectiveStyles() map[string]interface{} {
+
+	styles := map[string]interface{}{}
+
+	for kind, style := range c.AndroidStyles {
+		styles[kind] = map[string]string{
+			"channel":  style.Channel,
+			"sound":    style.Sound,
+			"priority": style.Priority,
+			"ttl":      style.TTL.String(),
+		}
+	}
+
+	return styles
+
+}
+
+// getConfig serves the effective configuration, to tell which environment
+// variables took effect on a deployment.
+func (s *Server) getConfig(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.cfg.effective())
+
+}
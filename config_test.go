@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTLSFiles(t *testing.T) {
+
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	key := filepath.Join(dir, "key.pem")
+
+	for _, path := range []string{cert, key} {
+
+		if err := os.WriteFile(path, []byte("pem"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+	}
+
+	tests := []struct {
+		name    string
+		cert    string
+		key     string
+		wantErr bool
+	}{
+		{"unset", "", "", false},
+		{"both", cert, key, false},
+		{"cert only", cert, "", true},
+		{"key only", "", key, true},
+		{"missing cert", filepath.Join(dir, "nope.pem"), key, true},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			t.Setenv("TLS_CERT_FILE", tt.cert)
+			t.Setenv("TLS_KEY_FILE", tt.key)
+
+			gotCert, gotKey, err := loadTLSFiles()
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadTLSFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (gotCert != tt.cert || gotKey != tt.key) {
+				t.Errorf("loadTLSFiles() = %q, %q; want %q, %q", gotCert, gotKey, tt.cert, tt.key)
+			}
+
+		})
+
+	}
+
+}
+
+func TestLoadConfigStreamMax(t *testing.T) {
+
+	for value, wantErr := range map[string]bool{"1": false, "0": true, "-1": true} {
+
+		t.Setenv("STREAM_MAX_CLIENTS", value)
+
+		if _, err := loadConfig(); (err != nil) != wantErr {
+			t.Errorf("STREAM_MAX_CLIENTS=%s: loadConfig() error = %v, wantErr %v", value, err, wantErr)
+		}
+
+	}
+
+}
+
+func TestGetConfigRedactsSecrets(t *testing.T) {
+
+	s := &Server{cfg: Config{
+		TempMax:         30,
+		Location:        defaultTimeZone,
+		Locale:          "es",
+		APIKey:          "api-secret",
+		SMTPHost:        "smtp.example.com",
+		SMTPUser:        "smtp-user",
+		SMTPPass:        "smtp-secret",
+		EmailTo:         []string{"ops@example.com"},
+		WebhookURL:      "https://hooks.example.com/hook-secret",
+		SlackWebhookURL: "https://hooks.slack.com/services/slack-secret",
+	}}
+
+	w := httptest.NewRecorder()
+	s.getConfig(w, httptest.NewRequest("GET", "/config", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	body := w.Body.String()
+
+	for _, secret := range []string{"api-secret", "smtp-user", "smtp-secret", "hook-secret", "slack-secret"} {
+
+		if strings.Contains(body, secret) {
+			t.Errorf("config leaks %q: %s", secret, body)
+		}
+
+	}
+
+	for _, want := range []string{`"timezone":"CST"`, `"tempMax":30`, `"apiKey":true`, `"host":"smtp.example.com"`} {
+
+		if !strings.Contains(body, want) {
+			t.Errorf("config missing %s: %s", want, body)
+		}
+
+	}
+
+}
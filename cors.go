@@ -0,0 +1,30 @@
+package main
+
+import "net/http"
+
+// cors adds the CORS headers a browser dashboard on another origin needs to
+// call a read endpoint, and answers OPTIONS preflight requests itself. It is
+// only meant for the unauthenticated GET endpoints.
+func (s *Server) cors(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		w.Header().Set("Access-Control-Allow-Origin", s.cfg.CORSAllowOrigin)
+
+		if s.cfg.CORSAllowOrigin != "*" {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		if r.Method == "OPTIONS" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next(w, r)
+
+	}
+
+}
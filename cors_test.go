@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSPreflight(t *testing.T) {
+
+	s := &Server{cfg: Config{CORSAllowOrigin: "https://dashboard.example"}}
+	called := false
+	handler := s.cors(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	r := httptest.NewRequest("OPTIONS", "/temperatures?site=room-1", nil)
+	r.Header.Set("Origin", "https://dashboard.example")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	if called {
+		t.Error("preflight reached the wrapped handler")
+	}
+
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  "https://dashboard.example",
+		"Access-Control-Allow-Methods": "GET, OPTIONS",
+		"Access-Control-Allow-Headers": "Content-Type",
+	}
+
+	for header, value := range want {
+
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+
+	}
+
+}
+
+func TestCORSGet(t *testing.T) {
+
+	s := &Server{cfg: Config{CORSAllowOrigin: "*"}}
+	handler := s.cors(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/ambient?site=room-1", nil))
+
+	if w.Code != http.StatusTeapot {
+		t.Errorf("status = %d, want the wrapped handler's %d", w.Code, http.StatusTeapot)
+	}
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DebugReading is an ambient payload as sendAll decoded it, before the
+// derived values are filled in.
+type DebugReading struct {
+	Received time.Time `json:"received"`
+	Ambient
+}
+
+// readingBuffer keeps the last readings sendAll decoded, in memory, for
+// GET /debug/readings. A nil buffer keeps nothing.
+type readingBuffer struct {
+	mu       sync.Mutex
+	readings []DebugReading
+	next     int
+	full     bool
+}
+
+func newReadingBuffer(size int) *readingBuffer {
+
+	return &readingBuffer{readings: make([]DebugReading, size)}
+
+}
+
+// add stores the reading, overwriting the oldest once the buffer is full.
+func (b *readingBuffer) add(ambient Ambient, now time.Time) {
+
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.readings[b.next] = DebugReading{Received: now, Ambient: ambient}
+	b.next = (b.next + 1) % len(b.readings)
+	b.full = b.full || b.next == 0
+
+}
+
+// snapshot returns a copy of the stored readings, oldest first.
+func (b *readingBuffer) snapshot() []DebugReading {
+
+	if b == nil {
+		return []DebugReading{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.full {
+		return append([]DebugReading{}, b.readings[:b.next]...)
+	}
+
+	return append(append([]DebugReading{}, b.readings[b.next:]...), b.readings[:b.next]...)
+
+}
+
+// getDebugReadings answers GET /debug/readings with the buffered readings,
+// including the ones that raised no alert. It is only routed when
+// DEBUG_ENDPOINTS is set.
+func (s *Server) getDebugReadings(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"size":     s.cfg.DebugReadings,
+		"readings": s.readings.snapshot(),
+	})
+
+}
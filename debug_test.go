@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadingBuffer(t *testing.T) {
+
+	b := newReadingBuffer(3)
+	now := time.Now()
+
+	if got := b.snapshot(); len(got) != 0 {
+		t.Fatalf("empty snapshot = %v", got)
+	}
+
+	for i := 1; i <= 2; i++ {
+		b.add(Ambient{SiteID: "room-1", Movement: i}, now)
+	}
+
+	if got := b.snapshot(); len(got) != 2 || got[0].Movement != 1 || got[1].Movement != 2 {
+		t.Errorf("partial snapshot = %+v, want readings 1 and 2", got)
+	}
+
+	for i := 3; i <= 7; i++ {
+		b.add(Ambient{SiteID: "room-1", Movement: i}, now)
+	}
+
+	got := b.snapshot()
+
+	if len(got) != 3 || got[0].Movement != 5 || got[1].Movement != 6 || got[2].Movement != 7 {
+		t.Errorf("wrapped snapshot = %+v, want the last three oldest first", got)
+	}
+
+	var nilBuffer *readingBuffer
+	nilBuffer.add(Ambient{}, now)
+
+	if got := nilBuffer.snapshot(); len(got) != 0 {
+		t.Errorf("nil buffer snapshot = %v, want none", got)
+	}
+
+}
+
+func TestReadingBufferConcurrent(t *testing.T) {
+
+	b := newReadingBuffer(10)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+
+		wg.Add(1)
+
+		go func(i int) {
+
+			defer wg.Done()
+			b.add(Ambient{SiteID: "room-1", Movement: i}, time.Now())
+			b.snapshot()
+
+		}(i)
+
+	}
+
+	wg.Wait()
+
+	if got := b.snapshot(); len(got) != 10 {
+		t.Errorf("%d readings kept, want 10", len(got))
+	}
+
+}
+
+func TestSendAllRecordsDebugReadings(t *testing.T) {
+
+	s := &Server{
+		cfg:      Config{MaxBodyBytes: 1 << 10, DebugReadings: 5},
+		readings: newReadingBuffer(5),
+	}
+
+	// The reading fails validation but is still buffered.
+	r := httptest.NewRequest("POST", "/sendAll", strings.NewReader(`{"siteId":"room-1","temperature":200}`))
+	r.Header.Set("Content-Type", "application/json")
+	s.sendAll(httptest.NewRecorder(), r)
+
+	w := httptest.NewRecorder()
+	s.getDebugReadings(w, httptest.NewRequest("GET", "/debug/readings", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var body struct {
+		Readings []DebugReading `json:"readings"`
+	}
+
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.Readings) != 1 || body.Readings[0].Temperature != 200 || body.Readings[0].Received.IsZero() {
+		t.Errorf("readings = %+v, want the rejected payload", body.Readings)
+	}
+
+}
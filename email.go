@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds the whole SMTP exchange, dial included; net/smtp has no
+// context.
+const smtpTimeout = 10 * time.Second
+
+// emailBoundary separates the parts of the alert email.
+const emailBoundary = "monitor-alert"
+
+// emailMessage builds a multipart/alternative email with a plain-text part
+// and an HTML part rendered from the "<br>"-separated body.
+func emailMessage(from string, to []string, subject, body string) []byte {
+
+	var msg bytes.Buffer
+
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", emailBoundary)
+
+	fmt.Fprintf(&msg, "--%s\r\n", emailBoundary)
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n", strings.ReplaceAll(body, "<br>", "\r\n"))
+
+	fmt.Fprintf(&msg, "--%s\r\n", emailBoundary)
+	fmt.Fprintf(&msg, "Content-Type: text/html; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "<p>%s</p>\r\n", body)
+
+	fmt.Fprintf(&msg, "--%s--\r\n", emailBoundary)
+
+	return msg.Bytes()
+
+}
+
+// sendEmailAlert emails the alert for a reading to ALERT_EMAIL_TO, using
+// STARTTLS when the server offers it and authenticating when SMTP_USER is
+// set.
+func (s *Server) sendEmailAlert(ambient Ambient) (err error) {
+
+	title, body := s.alertText(ambient)
+	addr := net.JoinHostPort(s.cfg.SMTPHost, strconv.Itoa(s.cfg.SMTPPort))
+
+	deadline := time.Now().Add(smtpTimeout)
+	conn, err := (&net.Dialer{Deadline: deadline}).Dial("tcp", addr)
+
+	if err != nil {
+		return
+	}
+
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.cfg.SMTPHost)
+
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+
+		if err = client.StartTLS(&tls.Config{ServerName: s.cfg.SMTPHost}); err != nil {
+			return
+		}
+
+	}
+
+	if s.cfg.SMTPUser != "" {
+
+		if err = client.Auth(smtp.PlainAuth("", s.cfg.SMTPUser, s.cfg.SMTPPass, s.cfg.SMTPHost)); err != nil {
+			return
+		}
+
+	}
+
+	if err = client.Mail(s.cfg.SMTPFrom); err != nil {
+		return
+	}
+
+	for _, to := range s.cfg.EmailTo {
+
+		if err = client.Rcpt(to); err != nil {
+			return
+		}
+
+	}
+
+	data, err := client.Data()
+
+	if err != nil {
+		return
+	}
+
+	if _, err = data.Write(emailMessage(s.cfg.SMTPFrom, s.cfg.EmailTo, title, body)); err != nil {
+		return
+	}
+
+	if err = data.Close(); err != nil {
+		return
+	}
+
+	return client.Quit()
+
+}
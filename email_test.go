@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmailMessage(t *testing.T) {
+
+	msg := string(emailMessage("monitor@example.com", []string{"a@example.com", "b@example.com"}, "[room-1] Alerta de Ambiente", "Temperatura: 31.00°C<br>Humedad: 40%"))
+
+	for _, want := range []string{
+		"From: monitor@example.com\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: [room-1] Alerta de Ambiente\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n\r\nTemperatura: 31.00°C\r\nHumedad: 40%\r\n",
+		"Content-Type: text/html; charset=utf-8\r\n\r\n<p>Temperatura: 31.00°C<br>Humedad: 40%</p>\r\n",
+		"--monitor-alert--\r\n",
+	} {
+
+		if !strings.Contains(msg, want) {
+			t.Errorf("message missing %q:\n%s", want, msg)
+		}
+
+	}
+
+}
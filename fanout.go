@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/messaging"
+)
+
+// multicastOutcome is what sending one multicast batch did.
+type multicastOutcome struct {
+	sent   int
+	failed int
+	pruned int
+	err    error
+}
+
+// sendMulticasts splits message.Tokens into multicast batches and sends them
+// on up to MaxConcurrentSends workers, returning each batch's outcome in
+// order. refs must match the tokens. Batches not started by the time ctx is
+// done fail with its error.
+func (s *Server) sendMulticasts(ctx context.Context, message messaging.MulticastMessage, refs []*firestore.DocumentRef) []multicastOutcome {
+
+	tokens := message.Tokens
+	batches := (len(tokens) + multicastLimit - 1) / multicastLimit
+	outcomes := make([]multicastOutcome, batches)
+	started := make([]bool, batches)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for n := min(max(s.cfg.MaxConcurrentSends, 1), batches); n > 0; n-- {
+
+		wg.Add(1)
+
+		go func() {
+
+			defer wg.Done()
+
+			for i := range jobs {
+
+				start := i * multicastLimit
+				end := min(start+multicastLimit, len(tokens))
+
+				batch := message
+				batch.Tokens = tokens[start:end]
+				outcomes[i] = s.sendMulticastBatch(ctx, &batch, refs[start:end])
+
+			}
+
+		}()
+
+	}
+
+dispatch:
+	for i := 0; i < batches && ctx.Err() == nil; i++ {
+
+		select {
+		case jobs <- i:
+			started[i] = true
+		case <-ctx.Done():
+			break dispatch
+		}
+
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	for i := range outcomes {
+
+		if !started[i] {
+			start := i * multicastLimit
+			outcomes[i] = multicastOutcome{failed: min(start+multicastLimit, len(tokens)) - start, err: ctx.Err()}
+		}
+
+	}
+
+	return outcomes
+
+}
+
+// sendMulticastBatch sends one batch and prunes the tokens FCM no longer
+// knows. A panic is recovered and reported as the batch failing, so it
+// can't take the process down from a worker goroutine.
+func (s *Server) sendMulticastBatch(ctx context.Context, message *messaging.MulticastMessage, refs []*firestore.DocumentRef) (outcome multicastOutcome) {
+
+	defer func() {
+
+		if p := recover(); p != nil {
+			slog.Error("multicast batch panicked", "op", "broadcast", "tokens", len(message.Tokens), "panic", p)
+			outcome = multicastOutcome{failed: len(message.Tokens), err: fmt.Errorf("multicast batch panicked: %v", p)}
+		}
+
+	}()
+
+	resp, err := s.fcm.SendMulticast(ctx, message)
+	s.breaker.record(err, time.Now())
+
+	if err != nil {
+		slog.Error("send multicast batch", "op", "broadcast", "tokens", len(message.Tokens), "err", err)
+		return multicastOutcome{failed: len(message.Tokens), err: err}
+	}
+
+	outcome.sent = resp.SuccessCount
+	outcome.failed = resp.FailureCount
+
+	if outcome.pruned, err = s.pruneTokens(ctx, refs, resp); err != nil {
+		slog.Error("prune tokens", "op", "broadcast", "collection", s.cfg.Collections.Tokens, "err", err)
+	}
+
+	return
+
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/messaging"
+)
+
+// funcNotifier sends multicasts with a function, so a test can make a batch
+// block, panic or cancel.
+type funcNotifier struct {
+	multicast func(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error)
+}
+
+func (f funcNotifier) Send(ctx context.Context, message *messaging.Message) (string, error) {
+
+	return "fake-id", nil
+
+}
+
+func (f funcNotifier) SendMulticast(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+
+	return f.multicast(ctx, message)
+
+}
+
+func delivered(message *messaging.MulticastMessage) *messaging.BatchResponse {
+
+	resp := &messaging.BatchResponse{SuccessCount: len(message.Tokens)}
+
+	for range message.Tokens {
+		resp.Responses = append(resp.Responses, &messaging.SendResponse{Success: true, MessageID: "fake-id"})
+	}
+
+	return resp
+
+}
+
+func fanOutTokens(n int) (messaging.MulticastMessage, []*firestore.DocumentRef) {
+
+	tokens := make([]string, n)
+
+	for i := range tokens {
+		tokens[i] = fmt.Sprintf("token-%d", i)
+	}
+
+	return messaging.MulticastMessage{Tokens: tokens}, make([]*firestore.DocumentRef, n)
+
+}
+
+func TestSendMulticasts(t *testing.T) {
+
+	fcm := &fakeNotifier{}
+	s := &Server{cfg: Config{MaxConcurrentSends: 3}, fcm: fcm}
+
+	message, refs := fanOutTokens(1234)
+	outcomes := s.sendMulticasts(context.Background(), message, refs)
+
+	if len(outcomes) != 3 || len(fcm.multicasts) != 3 {
+		t.Fatalf("%d outcomes and %d multicasts, want 3 of each", len(outcomes), len(fcm.multicasts))
+	}
+
+	for i, want := range []int{500, 500, 234} {
+
+		if outcomes[i].sent != want || outcomes[i].err != nil {
+			t.Errorf("batch %d = %+v, want %d sent", i, outcomes[i], want)
+		}
+
+	}
+
+}
+
+func TestSendMulticastsPanic(t *testing.T) {
+
+	s := &Server{cfg: Config{MaxConcurrentSends: 2}, fcm: funcNotifier{
+		multicast: func(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+
+			if message.Tokens[0] == "token-500" {
+				panic("boom")
+			}
+
+			return delivered(message), nil
+
+		},
+	}}
+
+	message, refs := fanOutTokens(1500)
+	outcomes := s.sendMulticasts(context.Background(), message, refs)
+
+	if outcomes[1].err == nil || outcomes[1].failed != 500 {
+		t.Errorf("panicking batch = %+v, want 500 failed with an error", outcomes[1])
+	}
+
+	if outcomes[0].sent != 500 || outcomes[2].sent != 500 {
+		t.Errorf("other batches = %+v, %+v; want them sent", outcomes[0], outcomes[2])
+	}
+
+}
+
+func TestSendMulticastsCancelled(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := &Server{cfg: Config{MaxConcurrentSends: 1}, fcm: funcNotifier{
+		multicast: func(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+
+			cancel()
+			return delivered(message), nil
+
+		},
+	}}
+
+	message, refs := fanOutTokens(2500)
+	outcomes := s.sendMulticasts(ctx, message, refs)
+
+	if outcomes[0].sent != 500 {
+		t.Errorf("first batch = %+v, want it sent", outcomes[0])
+	}
+
+	// The batch after the cancelling one may or may not have started.
+	for i := 2; i < len(outcomes); i++ {
+
+		if !errors.Is(outcomes[i].err, context.Canceled) || outcomes[i].failed != 500 {
+			t.Errorf("batch %d = %+v, want it failed as cancelled", i, outcomes[i])
+		}
+
+	}
+
+}
+
+// BenchmarkSendMulticasts fans 5000 tokens out to a notifier with a fixed
+// latency per call, serially and through the worker pool.
+func BenchmarkSendMulticasts(b *testing.B) {
+
+	fcm := funcNotifier{
+		multicast: func(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+
+			time.Sleep(5 * time.Millisecond)
+			return delivered(message), nil
+
+		},
+	}
+
+	message, refs := fanOutTokens(5000)
+
+	for _, workers := range []int{1, 4, 10} {
+
+		name := fmt.Sprintf("pooled-%d", workers)
+
+		if workers == 1 {
+			name = "serial"
+		}
+
+		b.Run(name, func(b *testing.B) {
+
+			s := &Server{cfg: Config{MaxConcurrentSends: workers}, fcm: fcm}
+
+			for i := 0; i < b.N; i++ {
+				s.sendMulticasts(context.Background(), message, refs)
+			}
+
+		})
+
+	}
+
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipMinSize is the smallest response worth compressing; anything shorter
+// is sent as is.
+const gzipMinSize = 1024
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+
+	for _, part := range strings.Split(header, ",") {
+
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+
+		if strings.TrimSpace(name) != "gzip" {
+			continue
+		}
+
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
+		}
+
+		return true
+
+	}
+
+	return false
+
+}
+
+// gzipWriter holds back the response until gzipMinSize bytes are written,
+// then compresses it. A shorter response, or one flushed early, goes out
+// uncompressed.
+type gzipWriter struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+	gz     *gzip.Writer
+	sent   bool
+}
+
+func (g *gzipWriter) WriteHeader(code int) {
+
+	if g.status == 0 {
+		g.status = code
+	}
+
+}
+
+func (g *gzipWriter) Write(b []byte) (int, error) {
+
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+
+	if g.sent {
+		return g.ResponseWriter.Write(b)
+	}
+
+	g.buf.Write(b)
+
+	if g.buf.Len() >= gzipMinSize {
+
+		if err := g.startGzip(); err != nil {
+			return 0, err
+		}
+
+	}
+
+	return len(b), nil
+
+}
+
+// startGzip switches to gzip and writes the buffered bytes through it.
+func (g *gzipWriter) startGzip() error {
+
+	header := g.Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+
+	g.ResponseWriter.WriteHeader(g.statusCode())
+	g.gz = gzip.NewWriter(g.ResponseWriter)
+
+	_, err := g.gz.Write(g.buf.Bytes())
+	g.buf.Reset()
+	return err
+
+}
+
+// send writes the header and the buffered bytes uncompressed.
+func (g *gzipWriter) send() {
+
+	g.sent = true
+	g.ResponseWriter.WriteHeader(g.statusCode())
+	g.ResponseWriter.Write(g.buf.Bytes())
+	g.buf.Reset()
+
+}
+
+func (g *gzipWriter) statusCode() int {
+
+	if g.status == 0 {
+		return http.StatusOK
+	}
+
+	return g.status
+
+}
+
+// Flush sends what has been written so far.
+func (g *gzipWriter) Flush() {
+
+	switch {
+	case g.gz != nil:
+		g.gz.Flush()
+	case !g.sent:
+		g.send()
+	}
+
+	if flusher, ok := g.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+}
+
+// close finishes the response once the handler returns.
+func (g *gzipWriter) close() {
+
+	switch {
+	case g.gz != nil:
+		g.gz.Close()
+	case !g.sent:
+		g.send()
+	}
+
+}
+
+// compress gzips the responses of a read endpoint for clients that accept
+// it. It is meant for the GET endpoints, not for ingest or /stream.
+func compress(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if r.Method == "HEAD" || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next(w, r)
+			return
+		}
+
+		g := &gzipWriter{ResponseWriter: w}
+		defer g.close()
+
+		next(g, r)
+
+	}
+
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.8", true},
+		{"gzip;q=0", false},
+		{"br", false},
+	}
+
+	for _, tt := range tests {
+
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+
+	}
+
+}
+
+func TestCompress(t *testing.T) {
+
+	large := strings.Repeat("temperature ", gzipMinSize)
+
+	tests := []struct {
+		name     string
+		body     string
+		encoding string
+		wantGzip bool
+	}{
+		{"large", large, "gzip", true},
+		{"small", "{}", "gzip", false},
+		{"not accepted", large, "", false},
+	}
+
+	for _, tt := range tests {
+
+		handler := compress(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, tt.body)
+		})
+
+		r := httptest.NewRequest("GET", "/temperatures", nil)
+		r.Header.Set("Accept-Encoding", tt.encoding)
+		w := httptest.NewRecorder()
+
+		handler(w, r)
+
+		if got := w.Header().Get("Content-Encoding") == "gzip"; got != tt.wantGzip {
+			t.Fatalf("%s: gzip = %v, want %v", tt.name, got, tt.wantGzip)
+		}
+
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: Vary = %q", tt.name, w.Header().Get("Vary"))
+		}
+
+		var body io.Reader = w.Body
+
+		if tt.wantGzip {
+
+			gz, err := gzip.NewReader(w.Body)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body = gz
+
+		}
+
+		if got, _ := io.ReadAll(body); string(got) != tt.body {
+			t.Errorf("%s: body has %d bytes, want %d", tt.name, len(got), len(tt.body))
+		}
+
+	}
+
+}
+
+func TestCompressStatus(t *testing.T) {
+
+	handler := compress(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("No readings"))
+	})
+
+	r := httptest.NewRequest("GET", "/ambient", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	handler(w, r)
+
+	if w.Code != http.StatusNotFound || w.Body.String() != "No readings" {
+		t.Errorf("got %d %q, want 404 No readings", w.Code, w.Body.String())
+	}
+
+}
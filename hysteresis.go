@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sync"
+)
+
+// Humidity alerts tracked for hysteresis, one of each per sensor.
+const (
+	humidityHigh = "humidity-high"
+	humidityLow  = "humidity-low"
+)
+
+// humidityState remembers, per sensor, which humidity alerts have fired and
+// not cleared yet. A fired alert is disarmed until humidity comes back past
+// its threshold by HumidityHysteresis, so humidity hovering at the threshold
+// doesn't alert on every crossing. A nil state keeps every alert armed.
+type humidityState struct {
+	mu        sync.Mutex
+	triggered map[string]bool
+}
+
+func newHumidityState() *humidityState {
+
+	return &humidityState{triggered: map[string]bool{}}
+
+}
+
+// armed reports whether the humidity alert of the given kind may fire for
+// the source, as Ambient.source names it.
+func (h *humidityState) armed(source, kind string) bool {
+
+	if h == nil {
+		return true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return !h.triggered[alertKey(source, kind)]
+
+}
+
+// observe re-arms the sensor's humidity alerts the reading has cleared.
+func (h *humidityState) observe(ambient Ambient, c Config) {
+
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if ambient.Humidity < c.HumidityMax-c.HumidityHysteresis {
+		delete(h.triggered, alertKey(ambient.source(), humidityHigh))
+	}
+
+	if ambient.Humidity > c.HumidityMin+c.HumidityHysteresis {
+		delete(h.triggered, alertKey(ambient.source(), humidityLow))
+	}
+
+}
+
+// trigger disarms the humidity alerts a sent alert for the reading covered.
+func (h *humidityState) trigger(ambient Ambient, c Config) {
+
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if ambient.Humidity > c.HumidityMax {
+		h.triggered[alertKey(ambient.source(), humidityHigh)] = true
+	}
+
+	if ambient.Humidity < c.HumidityMin {
+		h.triggered[alertKey(ambient.source(), humidityLow)] = true
+	}
+
+}
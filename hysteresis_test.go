@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func hysteresisServer(hysteresis float64) (*Server, *fakeNotifier) {
+
+	fcm := &fakeNotifier{}
+	s := &Server{
+		cfg: Config{
+			TempMax:            35,
+			HeatIndexMax:       40,
+			HumidityMax:        70,
+			HumidityMin:        30,
+			HumidityHysteresis: hysteresis,
+			Location:           defaultTimeZone,
+			TempUnit:           "C",
+			Locale:             "en",
+			UseTopic:           true,
+			TopicName:          "alerts",
+		},
+		fcm:      fcm,
+		lastSent: map[string]time.Time{},
+	}
+
+	if hysteresis > 0 {
+		s.humidity = newHumidityState()
+	}
+
+	return s, fcm
+
+}
+
+// sendHumidity sends one reading per humidity and reports which of them
+// raised an alert.
+func sendHumidity(t *testing.T, s *Server, humidities []float64) (alerted []bool) {
+
+	t.Helper()
+
+	for _, humidity := range humidities {
+
+		_, err := s.sendPushNotification(context.Background(), Ambient{SiteID: "room-1", Temperature: 22, HeatIndex: 22, Humidity: humidity})
+
+		if err != nil && !errors.Is(err, errWithinThresholds) {
+			t.Fatalf("humidity %v: sendPushNotification() = %v", humidity, err)
+		}
+
+		alerted = append(alerted, err == nil)
+
+	}
+
+	return
+
+}
+
+func TestHumidityHysteresis(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		hysteresis float64
+		humidities []float64
+		want       []bool
+	}{
+		{
+			"oscillating above the max",
+			5,
+			[]float64{71, 69, 71, 68, 70.5, 66, 71},
+			[]bool{true, false, false, false, false, false, false},
+		},
+		{
+			"re-armed below max minus hysteresis",
+			5,
+			[]float64{71, 69, 71, 64, 71},
+			[]bool{true, false, false, false, true},
+		},
+		{
+			"oscillating below the min",
+			5,
+			[]float64{29, 31, 29, 36, 29},
+			[]bool{true, false, false, false, true},
+		},
+		{
+			"disabled",
+			0,
+			[]float64{71, 69, 71, 69, 71},
+			[]bool{true, false, true, false, true},
+		},
+	}
+
+	for _, tt := range tests {
+
+		s, _ := hysteresisServer(tt.hysteresis)
+		got := sendHumidity(t, s, tt.humidities)
+
+		for i := range tt.want {
+
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: reading %d (%v%%) alerted = %v, want %v", tt.name, i, tt.humidities[i], got[i], tt.want[i])
+			}
+
+		}
+
+	}
+
+}
+
+func TestHumidityHysteresisTemperature(t *testing.T) {
+
+	s, fcm := hysteresisServer(5)
+	sendHumidity(t, s, []float64{71})
+
+	// A disarmed humidity alert doesn't hold back a temperature alert.
+	_, err := s.sendPushNotification(context.Background(), Ambient{SiteID: "room-1", Temperature: 36, HeatIndex: 36, Humidity: 71})
+
+	if err != nil || len(fcm.sent) != 2 {
+		t.Errorf("temperature alert = %v with %d sent, want it sent", err, len(fcm.sent))
+	}
+
+	if !s.humidity.armed("room-2", humidityHigh) {
+		t.Error("another site's humidity alert was disarmed")
+	}
+
+}
+
+func TestHumidityHysteresisPerSensor(t *testing.T) {
+
+	s, fcm := hysteresisServer(5)
+	sendHumidity(t, s, []float64{71})
+
+	// The default sensor's disarmed alert doesn't hold back another sensor's.
+	rack := Ambient{SiteID: "room-1", SensorID: "rack-2", Temperature: 22, HeatIndex: 22, Humidity: 71}
+
+	if _, err := s.sendPushNotification(context.Background(), rack); err != nil {
+		t.Fatalf("rack-2: sendPushNotification() = %v, want it sent", err)
+	}
+
+	if _, err := s.sendPushNotification(context.Background(), rack); !errors.Is(err, errWithinThresholds) {
+		t.Errorf("rack-2 again: sendPushNotification() = %v, want it disarmed", err)
+	}
+
+	if len(fcm.sent) != 2 {
+		t.Errorf("%d alerts sent, want one per sensor", len(fcm.sent))
+	}
+
+	if s.humidity.armed("room-1", humidityHigh) || s.humidity.armed("room-1/rack-2", humidityHigh) {
+		t.Error("a sensor's humidity alert is still armed after firing")
+	}
+
+}
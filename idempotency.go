@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotentResponse is the response recorded for an Idempotency-Key.
+// done is false while the first request is still being processed.
+type idempotentResponse struct {
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// idempotencyStore remembers the responses of recent ingest requests by
+// Idempotency-Key, in memory, for ttl and at most max keys.
+type idempotencyStore struct {
+	ttl time.Duration
+	max int
+
+	mu        sync.Mutex
+	responses map[string]*idempotentResponse
+}
+
+func newIdempotencyStore(ttl time.Duration, max int) *idempotencyStore {
+
+	return &idempotencyStore{ttl: ttl, max: max, responses: map[string]*idempotentResponse{}}
+
+}
+
+// begin returns the response recorded for key, if any. Otherwise it reserves
+// the key for the caller, who must finish or release it.
+func (st *idempotencyStore) begin(key string, now time.Time) (*idempotentResponse, bool) {
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if resp, ok := st.responses[key]; ok && now.Before(resp.expires) {
+		return resp, true
+	}
+
+	if len(st.responses) >= st.max {
+		st.evict(now)
+	}
+
+	st.responses[key] = &idempotentResponse{expires: now.Add(st.ttl)}
+	return nil, false
+
+}
+
+// evict drops the expired keys and, when still full, the one expiring
+// first. st.mu must be held.
+func (st *idempotencyStore) evict(now time.Time) {
+
+	var oldest string
+
+	for key, resp := range st.responses {
+
+		if !now.Before(resp.expires) {
+			delete(st.responses, key)
+			continue
+		}
+
+		if oldest == "" || resp.expires.Before(st.responses[oldest].expires) {
+			oldest = key
+		}
+
+	}
+
+	if len(st.responses) >= st.max {
+		delete(st.responses, oldest)
+	}
+
+}
+
+func (st *idempotencyStore) finish(key string, resp idempotentResponse) {
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if reserved, ok := st.responses[key]; ok {
+		resp.done = true
+		resp.expires = reserved.expires
+		st.responses[key] = &resp
+	}
+
+}
+
+// release forgets key so a retry is processed again.
+func (st *idempotencyStore) release(key string) {
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	delete(st.responses, key)
+
+}
+
+// responseCapture copies what a handler writes so it can be replayed.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) WriteHeader(code int) {
+
+	if c.status == 0 {
+		c.status = code
+	}
+
+	c.ResponseWriter.WriteHeader(code)
+
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+
+}
+
+// idempotent replays the recorded response for a repeated Idempotency-Key
+// header instead of processing the request again. A repeat that arrives
+// while the first is still running gets 409, and a 5xx response is not
+// kept so the retry goes through. Requests without the header are not
+// affected.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		header := r.Header.Get("Idempotency-Key")
+
+		if s.idempotency == nil || header == "" {
+			next(w, r)
+			return
+		}
+
+		key := r.URL.Path + " " + header
+		resp, seen := s.idempotency.begin(key, time.Now())
+
+		if seen && !resp.done {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("Request in progress"))
+			return
+		}
+
+		if seen {
+
+			if resp.contentType != "" {
+				w.Header().Set("Content-Type", resp.contentType)
+			}
+
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(resp.status)
+			w.Write(resp.body)
+			return
+
+		}
+
+		capture := &responseCapture{ResponseWriter: w}
+		next(capture, r)
+
+		if capture.status == 0 {
+			capture.status = http.StatusOK
+		}
+
+		if capture.status >= 500 {
+			s.idempotency.release(key)
+			return
+		}
+
+		s.idempotency.finish(key, idempotentResponse{
+			status:      capture.status,
+			contentType: w.Header().Get("Content-Type"),
+			body:        capture.body.Bytes(),
+		})
+
+	}
+
+}
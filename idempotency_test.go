@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIdempotent(t *testing.T) {
+
+	calls := 0
+	s := &Server{idempotency: newIdempotencyStore(time.Minute, 10)}
+
+	handler := s.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"sent":1}`))
+	})
+
+	send := func(key string) *httptest.ResponseRecorder {
+
+		r := httptest.NewRequest("POST", "/sendAll", nil)
+		r.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+
+	}
+
+	first := send("reading-1")
+	second := send("reading-1")
+
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls)
+	}
+
+	if second.Code != first.Code || second.Body.String() != `{"sent":1}` || second.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("replay = %d %q, want the first response", second.Code, second.Body.String())
+	}
+
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("replay not marked")
+	}
+
+	send("reading-2")
+
+	if calls != 2 {
+		t.Errorf("handler ran %d times after a new key, want 2", calls)
+	}
+
+}
+
+func TestIdempotentServerError(t *testing.T) {
+
+	calls := 0
+	s := &Server{idempotency: newIdempotencyStore(time.Minute, 10)}
+
+	handler := s.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("POST", "/writeTemp", nil)
+		r.Header.Set("Idempotency-Key", "retry")
+		handler(httptest.NewRecorder(), r)
+	}
+
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want the retry after a 5xx to run again", calls)
+	}
+
+}
+
+func TestIdempotencyStoreLimits(t *testing.T) {
+
+	st := newIdempotencyStore(time.Minute, 2)
+	now := time.Now()
+
+	st.begin("a", now)
+	st.finish("a", idempotentResponse{status: http.StatusOK})
+	st.begin("b", now.Add(time.Second))
+	st.begin("c", now.Add(2*time.Second))
+
+	if _, ok := st.responses["a"]; ok || len(st.responses) != 2 {
+		t.Errorf("keys = %v, want the oldest evicted at the cap", st.responses)
+	}
+
+	if _, seen := st.begin("c", now.Add(3*time.Second)); !seen {
+		t.Error("in-flight key not seen")
+	}
+
+	if _, seen := st.begin("b", now.Add(2*time.Minute)); seen {
+		t.Error("expired key still seen")
+	}
+
+}
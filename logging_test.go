@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLogRequests(t *testing.T) {
+
+	var buf bytes.Buffer
+	defer func(l *slog.Logger) { slog.SetDefault(l) }(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	handler := logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Invalid Method"))
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/sendAll", nil))
+
+	if w.Code != http.StatusBadRequest || w.Body.String() != "Invalid Method" {
+		t.Errorf("response = %d %q, want 400 \"Invalid Method\"", w.Code, w.Body.String())
+	}
+
+	var entry struct {
+		Msg    string `json:"msg"`
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Status int    `json:"status"`
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log entry %q: %v", buf.String(), err)
+	}
+
+	if entry.Msg != "request" || entry.Method != "GET" || entry.Path != "/sendAll" || entry.Status != http.StatusBadRequest {
+		t.Errorf("log entry = %+v", entry)
+	}
+
+}
+
+func TestStatusRecorderDefaultsToOK(t *testing.T) {
+
+	rec := &statusRecorder{ResponseWriter: httptest.NewRecorder(), status: http.StatusOK}
+	rec.Write([]byte("OK"))
+	rec.WriteHeader(http.StatusInternalServerError)
+
+	if rec.status != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.status, http.StatusOK)
+	}
+
+	var _ http.Flusher = rec
+
+}
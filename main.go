@@ -1,18 +1,27 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"math"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go"
-	"firebase.google.com/go/messaging"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc/codes"
@@ -20,25 +29,186 @@ import (
 )
 
 type Ambient struct {
-	Temperature float64 `json:"temperature"`
-	Humidity    float64 `json:"humidity"`
-	HeatIndex   float64 `json:"heatIndex"`
-	Movement    int     `json:"move"`
+	SiteID      string  `json:"siteId" firestore:"siteId"`
+	SensorID    string  `json:"sensorId,omitempty" firestore:"sensorId"`
+	Temperature float64 `json:"temperature" firestore:"temperature"`
+	Humidity    float64 `json:"humidity" firestore:"humidity"`
+	HeatIndex   float64 `json:"heatIndex" firestore:"heatIndex"`
+	DewPoint    float64 `json:"dewPoint" firestore:"dewPoint"`
+	Movement    int     `json:"move" firestore:"move"`
+
+	// Schema is the payload version; see decodeAmbient.
+	Schema int `json:"schema,omitempty" firestore:"-"`
+
+	// SensorTime is when the sensor took the reading, if it says so. A
+	// reading older than MaxReadingAge is stored but raises no alert.
+	SensorTime *time.Time `json:"timestamp,omitempty" firestore:"sensorTimestamp,omitempty"`
+}
+
+// AmbientReading is an Ambient as stored in the ambient collection. The
+// timestamp is always filled in by Firestore when the reading is written.
+type AmbientReading struct {
+	Ambient
+	Timestamp time.Time `json:"timestamp" firestore:"timestamp,serverTimestamp"`
 }
 
 type LogTemperature struct {
+	SiteID         string  `json:"siteId"`
+	SensorID       string  `json:"sensorId,omitempty"`
 	AdjTemperature float64 `json:"adj_temperature"`
 	AvgTemperature float64 `json:"avg_temperature"`
+
+	// Schema is the payload version; see decodeLogTemperature.
+	Schema int `json:"schema,omitempty"`
+
+	// SensorTime is when the sensor took the reading, if it says so.
+	// Temperatures raise no alerts, so it is only accepted.
+	SensorTime *time.Time `json:"timestamp,omitempty"`
+}
+
+// defaultTimeZone is used when TZ_LOCATION is unset or cannot be loaded.
+var defaultTimeZone = time.FixedZone("CST", -6*3600)
+
+// errWithinThresholds is returned by sendPushNotification when an ambient
+// reading does not cross any alert threshold and nothing was sent.
+var errWithinThresholds = errors.New("ambient values within thresholds")
+
+// errCooldown is returned by sendPushNotification when an alert of the same
+// type was already sent within the configured cooldown window.
+var errCooldown = errors.New("alert suppressed by cooldown")
+
+// errDebounced is returned by sendPushNotification for a movement reading
+// that arrives right after another one and was neither logged nor sent.
+var errDebounced = errors.New("movement debounced")
+
+// errMessagingUnavailable is returned by broadcast when the Messaging client
+// failed to initialize. Readings are still logged and the other channels
+// still send.
+var errMessagingUnavailable = errors.New("messaging unavailable")
+
+// errStale is returned by sendAlert for a reading older than MaxReadingAge,
+// such as one flushed from a sensor's buffer.
+var errStale = errors.New("reading too old to alert")
+
+// errQuietHours is returned by sendAlert for a non-critical ambient alert
+// during the configured quiet hours.
+var errQuietHours = errors.New("alert suppressed by quiet hours")
+
+const (
+	alertTemperature = "temperature"
+	alertMovement    = "movement"
+)
+
+// Server holds the Firebase clients shared by every handler so they are
+// created once at startup instead of on each request.
+type Server struct {
+	cfg Config
+	fs  *firestore.Client
+	fcm Notifier
+
+	// lastSent is keyed by alertKey so each site has its own cooldowns.
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+
+	// lastMovement is the last logged movement per site, for debouncing.
+	moveMu       sync.Mutex
+	lastMovement map[string]time.Time
+
+	// breaker short-circuits FCM sends during an outage; nil when
+	// FCM_BREAKER_FAILURES is 0.
+	breaker *breaker
+
+	// limiter throttles the ingest endpoints per client IP; nil when
+	// RATE_LIMIT_PER_SECOND is 0.
+	limiter *rateLimiter
+
+	// idempotency holds the recent responses by Idempotency-Key.
+	idempotency *idempotencyStore
+
+	// humidity tracks the humidity alerts for hysteresis; nil when
+	// HUMIDITY_HYSTERESIS is 0.
+	humidity *humidityState
+
+	// tokenCache holds the last token list read per site; nil when
+	// TOKEN_CACHE_MAX_AGE is 0.
+	tokenCache *tokenCache
+
+	// readings holds the last decoded ambient payloads for
+	// /debug/readings; nil unless DEBUG_ENDPOINTS is set.
+	readings *readingBuffer
+
+	// streams counts the open /stream connections.
+	streams atomic.Int32
 }
 
-var timeZone = time.FixedZone("CST", -6*3600)
+// emulatorProjectID is the project used against the Firestore emulator when
+// GOOGLE_CLOUD_PROJECT is not set; the emulator accepts any ID.
+const emulatorProjectID = "monitor-dev"
+
+// errNoCredentials is returned by firebaseApp when no service account is
+// configured and the emulator isn't either.
+var errNoCredentials = errors.New("no credentials: set GOOGLE_CREDENTIALS_JSON or FILENAME_CREDENTIALS, or FIRESTORE_EMULATOR_HOST for the emulator")
+
+// credentials is a service account, either as raw JSON or as the path of a
+// file holding it.
+type credentials struct {
+	json string
+	file string
+}
 
-func firebaseApp(ctx context.Context) (app *firebase.App, err error) {
+// loadCredentials returns the credentials file named by key. When it is
+// unset, it falls back to the raw JSON in GOOGLE_CREDENTIALS_JSON, which
+// spares containers from writing the secret to disk, and then to
+// FILENAME_CREDENTIALS.
+func loadCredentials(key string) credentials {
 
-	credentials := os.Getenv("FILENAME_CREDENTIALS")
-	opts := []option.ClientOption{option.WithCredentialsFile(credentials)}
+	if file := os.Getenv(key); file != "" {
+		return credentials{file: file}
+	}
+
+	if raw := os.Getenv("GOOGLE_CREDENTIALS_JSON"); raw != "" {
+		return credentials{json: raw}
+	}
 
-	app, err = firebase.NewApp(ctx, nil, opts...)
+	return credentials{file: os.Getenv("FILENAME_CREDENTIALS")}
+
+}
+
+// firebaseApp initializes a Firebase app from the credentials, or, when
+// FIRESTORE_EMULATOR_HOST is set, without credentials so the Firestore
+// client talks to the emulator.
+func firebaseApp(ctx context.Context, creds credentials) (app *firebase.App, err error) {
+
+	var conf *firebase.Config
+	var opts []option.ClientOption
+
+	if host := os.Getenv("FIRESTORE_EMULATOR_HOST"); host != "" {
+
+		projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
+
+		if projectID == "" {
+			projectID = emulatorProjectID
+		}
+
+		slog.Info("using firestore emulator", "host", host, "project", projectID)
+		conf = &firebase.Config{ProjectID: projectID}
+		opts = append(opts, option.WithoutAuthentication())
+
+	} else if creds.json != "" {
+
+		if !json.Valid([]byte(creds.json)) {
+			return nil, fmt.Errorf("GOOGLE_CREDENTIALS_JSON is not valid JSON")
+		}
+
+		opts = append(opts, option.WithCredentialsJSON([]byte(creds.json)))
+
+	} else if creds.file != "" {
+		opts = append(opts, option.WithCredentialsFile(creds.file))
+	} else {
+		return nil, errNoCredentials
+	}
+
+	app, err = firebase.NewApp(ctx, conf, opts...)
 
 	if err != nil {
 		return nil, err
@@ -48,6 +218,168 @@ func firebaseApp(ctx context.Context) (app *firebase.App, err error) {
 
 }
 
+func newServer(ctx context.Context) (s *Server, err error) {
+
+	cfg, err := loadConfig()
+
+	if err != nil {
+		return
+	}
+
+	// Data and push notifications may live in separate Firebase projects,
+	// each with its own credentials.
+	storeCredentials := loadCredentials("FIRESTORE_CREDENTIALS")
+	pushCredentials := loadCredentials("FCM_CREDENTIALS")
+
+	storeApp, err := firebaseApp(ctx, storeCredentials)
+
+	if err != nil {
+		return
+	}
+
+	fs, err := storeApp.Firestore(ctx)
+
+	if err != nil {
+		return
+	}
+
+	s = &Server{
+		cfg:          cfg,
+		fs:           fs,
+		lastSent:     map[string]time.Time{},
+		lastMovement: map[string]time.Time{},
+		idempotency:  newIdempotencyStore(cfg.IdempotencyTTL, cfg.IdempotencyMax),
+	}
+
+	if cfg.RateLimit > 0 {
+		s.limiter = newRateLimiter(cfg.RateLimit, cfg.RateBurst)
+	}
+
+	if cfg.BreakerFailures > 0 {
+		s.breaker = newBreaker(cfg.BreakerFailures, cfg.BreakerCooldown)
+	}
+
+	if cfg.HumidityHysteresis > 0 {
+		s.humidity = newHumidityState()
+	}
+
+	if cfg.TokenCacheMaxAge > 0 {
+		s.tokenCache = newTokenCache(cfg.TokenCacheMaxAge)
+	}
+
+	if cfg.DebugEndpoints {
+		s.readings = newReadingBuffer(cfg.DebugReadings)
+	}
+
+	pushApp := storeApp
+
+	// Without FCM the server still logs readings; only push sends are skipped.
+	if pushCredentials != storeCredentials {
+
+		if pushApp, err = firebaseApp(ctx, pushCredentials); err != nil {
+			slog.Warn("push credentials unusable, push notifications disabled", "op", "newServer", "err", err)
+			return s, nil
+		}
+
+	}
+
+	fcm, err := pushApp.Messaging(ctx)
+
+	if err != nil {
+		slog.Warn("messaging unavailable, push notifications disabled", "op", "newServer", "err", err)
+		return s, nil
+	}
+
+	s.fcm = fcm
+
+	return s, nil
+
+}
+
+func (s *Server) Close() error {
+
+	return s.fs.Close()
+
+}
+
+// collection returns a per-site collection, sites/{site}/{name}.
+func (s *Server) collection(site, name string) *firestore.CollectionRef {
+
+	return s.fs.Collection(s.cfg.Collections.Sites).Doc(site).Collection(name)
+
+}
+
+// sensorCollection returns a per-sensor collection,
+// sites/{site}/sensors/{sensor}/{name}. The default sensor keeps the
+// per-site collection so data written before sensors existed stays put.
+func (s *Server) sensorCollection(site, sensor, name string) *firestore.CollectionRef {
+
+	if sensor == "" || sensor == defaultSensor {
+		return s.collection(site, name)
+	}
+
+	return s.collection(site, "sensors").Doc(sensor).Collection(name)
+
+}
+
+// tokenCollection returns the collection device tokens are read from and
+// registered in, scoped to the site when TOKENS_PER_SITE is set.
+func (s *Server) tokenCollection(site string) *firestore.CollectionRef {
+
+	if s.cfg.TokensPerSite {
+		return s.collection(site, s.cfg.Collections.Tokens)
+	}
+
+	return s.fs.Collection(s.cfg.Collections.Tokens)
+
+}
+
+func alertKey(site, alert string) string {
+
+	return site + "/" + alert
+
+}
+
+// inCooldown reports whether an alert with the given key was sent less than
+// the configured cooldown ago.
+func (s *Server) inCooldown(key string, now time.Time) bool {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last, ok := s.lastSent[key]
+	return ok && now.Sub(last) < s.cfg.Cooldown
+
+}
+
+func (s *Server) markSent(key string, now time.Time) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastSent[key] = now
+
+}
+
+// setupLogging installs a JSON slog handler as the default logger with the
+// given level name (debug, info, warn or error; info when empty).
+func setupLogging(level string) error {
+
+	var lvl slog.Level
+
+	if level != "" {
+
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid LOG_LEVEL: %w", err)
+		}
+
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: lvl})))
+	return nil
+
+}
+
 func countDocs(ite *firestore.DocumentIterator) (count int) {
 
 	for {
@@ -68,211 +400,686 @@ func countDocs(ite *firestore.DocumentIterator) (count int) {
 
 }
 
-func get12hrsWithSecs(t time.Time) string {
+// exceedsThresholds reports whether a reading calls for an ambient alert.
+// Humidity outside its band shares the alert, and so the cooldown, with
+// temperature and heat index, but only counts while its alert is armed; see
+// humidityState.
+func (s *Server) exceedsThresholds(ambient Ambient) bool {
+
+	c := s.cfg
 
-	time12 := t.Format(time.Kitchen)
-	offset := len(time12) - 2
-	return fmt.Sprintf("%s:%02d%s", time12[:offset], t.Second(), time12[offset:])
+	return ambient.Temperature > c.TempMax || ambient.HeatIndex > c.HeatIndexMax ||
+		ambient.Humidity > c.HumidityMax && s.humidity.armed(ambient.source(), humidityHigh) ||
+		ambient.Humidity < c.HumidityMin && s.humidity.armed(ambient.source(), humidityLow)
 
 }
 
-func sendPushNotification(ambient Ambient) (err error) {
+// Clock modes for TIME_FORMAT.
+const (
+	clock12h = "12h"
+	clock24h = "24h"
+)
 
-	ctx := context.Background()
-	app, err := firebaseApp(ctx)
+// formatClock formats the time of day with seconds, as 3:04:05PM in 12h mode
+// or 15:04:05 in 24h mode.
+func formatClock(t time.Time, mode string) string {
 
-	if err != nil {
-		return
+	if mode == clock24h {
+		return t.Format("15:04:05")
 	}
 
-	fcmClient, err := app.Messaging(ctx)
+	return t.Format("3:04:05PM")
 
-	if err != nil {
-		return
+}
+
+// inQuietHours reports whether t falls in the quiet hours window.
+func (c Config) inQuietHours(t time.Time) bool {
+
+	if c.QuietStart == c.QuietEnd {
+		return false
 	}
 
-	dbClient, err := app.Firestore(ctx)
+	local := t.In(c.Location)
+	offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
 
-	if err != nil {
-		return
+	if c.QuietStart < c.QuietEnd {
+		return offset >= c.QuietStart && offset < c.QuietEnd
 	}
 
-	data := map[string]string{
-		"Title": "Alerta de Ambiente",
-		"Body": fmt.Sprintf(
-			"Temperatura: %.2f°C<br>Humedad: %.0f%%<br>Indice de Calor: %.2f°C",
-			ambient.Temperature,
-			ambient.Humidity,
-			ambient.HeatIndex,
-		),
-		"Temp": "",
+	return offset >= c.QuietStart || offset < c.QuietEnd
+
+}
+
+// stale reports whether a reading carries a sensor time older than
+// MaxReadingAge. Readings without one are never stale.
+func (c Config) stale(ambient Ambient, now time.Time) bool {
+
+	return c.MaxReadingAge > 0 && ambient.SensorTime != nil && now.Sub(*ambient.SensorTime) > c.MaxReadingAge
+
+}
+
+// sendPushNotification logs a movement reading, unless it is debounced, and
+// then sends the alert for the reading.
+func (s *Server) sendPushNotification(ctx context.Context, ambient Ambient) (result SendResult, err error) {
+
+	if ambient.Movement > 0 {
+
+		now := time.Now()
+
+		if s.debounceMovement(ambient.SiteID, now) {
+			return result, errDebounced
+		}
+
+		s.logMovement(ctx, ambient.SiteID, now)
+
+	} else {
+		s.humidity.observe(ambient, s.cfg)
 	}
 
+	return s.sendAlert(ctx, ambient)
+
+}
+
+// sendAlert is deliverAlert for a real alert.
+func (s *Server) sendAlert(ctx context.Context, ambient Ambient) (SendResult, error) {
+
+	return s.deliverAlert(ctx, ambient, alertOptions{})
+
+}
+
+// alertOptions changes how deliverAlert treats an alert. A test alert is
+// labeled as such, only goes out as a push notification and has a cooldown
+// of its own, which skipCooldown ignores.
+type alertOptions struct {
+	test         bool
+	skipCooldown bool
+}
+
+// testPrefix labels the body of a test alert.
+const testPrefix = "[TEST] "
+
+// deliverAlert sends the alert for a reading on every configured channel. A
+// stale reading, a temperature reading within thresholds or in quiet hours,
+// or any alert still in its cooldown, is not sent.
+func (s *Server) deliverAlert(ctx context.Context, ambient Ambient, opts alertOptions) (result SendResult, err error) {
+
+	alert := alertTemperature
+
 	if ambient.Movement > 0 {
+		alert = alertMovement
+	}
 
-		data["Title"] = "¡Alguien ha entrado al site!"
-		data["Body"] = "Se han detectado lecturas de movimiento."
-		data["Move"] = ""
-		delete(data, "Temp")
+	key := alertKey(ambient.source(), alert)
 
-		t := time.Now().In(timeZone)
-		hour := get12hrsWithSecs(t)
-		collection := dbClient.Collection("movement")
+	if opts.test {
+		key += "/test"
+	}
 
-		docs, err := collection.Snapshots(ctx).Query.Documents(ctx).GetAll()
+	if s.cfg.stale(ambient, time.Now()) {
+		return result, errStale
+	}
 
-		if err != nil {
-			log.Println(err)
+	if alert == alertTemperature && !s.exceedsThresholds(ambient) {
+		return result, errWithinThresholds
+	}
+
+	if alert == alertTemperature && s.cfg.severity(ambient) != severityCritical && s.cfg.inQuietHours(time.Now()) {
+		return result, errQuietHours
+	}
+
+	if !opts.skipCooldown && s.inCooldown(key, time.Now()) {
+		return result, errCooldown
+	}
+
+	title, body := s.alertText(ambient)
+
+	if opts.test {
+		body = testPrefix + body
+	}
+
+	data := map[string]string{
+		"Title":    title,
+		"Body":     body,
+		"Site":     ambient.SiteID,
+		"Severity": s.cfg.severity(ambient),
+		"type":     typeAmbient,
+	}
+
+	if alert == alertMovement {
+		data["type"] = typeMovement
+	}
+
+	result, err = s.broadcast(ctx, ambient.SiteID, alert, data)
+
+	if opts.test {
+
+		if err == nil {
+			s.markSent(key, time.Now())
 		}
 
-		if len(docs) >= 7 {
-			_, err = docs[0].Ref.Delete(ctx)
+		return
+
+	}
+
+	delivered := s.notifyChannels(ctx, alert, ambient)
+
+	// A failed push is retried on the next reading, unless another channel
+	// delivered the alert: the cooldown then applies to keep that channel
+	// from repeating on every reading, as it does with messaging down.
+	if err != nil && !errors.Is(err, errMessagingUnavailable) && !delivered {
+		return
+	}
+
+	s.markSent(key, time.Now())
+	s.recordAlert(ctx, alert, ambient)
+
+	if alert == alertTemperature {
+		s.humidity.trigger(ambient, s.cfg)
+	}
+
+	return result, err
+
+}
+
+// notifyChannels sends the alert on the webhook, Slack and email channels
+// that are configured and reports whether any of them delivered it. They
+// run at once, each bounded by its own timeout on a context detached from
+// the request, so together they take as long as the slowest one.
+func (s *Server) notifyChannels(ctx context.Context, alert string, ambient Ambient) bool {
+
+	var delivered atomic.Bool
+	var wg sync.WaitGroup
 
-			if err != nil {
-				log.Println(err)
+	run := func(send func() bool) {
+
+		wg.Add(1)
+
+		go func() {
+
+			defer wg.Done()
+
+			if send() {
+				delivered.Store(true)
 			}
-		}
 
-		year, month, day := t.Date()
+		}()
 
-		doc := collection.Doc(fmt.Sprintf("%d-%d-%d", year, month, day))
-		snapshot, err := doc.Get(ctx)
+	}
 
-		if status.Code(err) == codes.NotFound {
+	run(func() bool { return s.notifyWebhook(ctx, alert, ambient) })
 
-			doc.Set(ctx, map[string]interface{}{
-				"move_logs": []string{hour},
-			})
+	if s.cfg.SlackWebhookURL != "" {
 
-		} else if err != nil {
+		run(func() bool {
 
-			log.Println(err)
+			if err := s.sendSlackAlert(ctx, ambient); err != nil {
+				slog.Error("send slack alert", "op", "sendAlert", "site", ambient.SiteID, "alert", alert, "err", err)
+				return false
+			}
 
-		} else {
+			return true
 
-			moves, _ := snapshot.DataAt("move_logs")
-			logs := moves.([]interface{})
-			logs = append(logs, hour)
+		})
 
-			_, err = snapshot.Ref.Update(ctx, []firestore.Update{{Path: "move_logs", Value: logs}})
+	}
+
+	if s.cfg.Email() {
 
-			if err != nil {
-				log.Println(err)
+		run(func() bool {
+
+			if err := s.sendEmailAlert(ambient); err != nil {
+				slog.Error("send email alert", "op", "sendAlert", "site", ambient.SiteID, "alert", alert, "err", err)
+				return false
 			}
 
-		}
+			return true
+
+		})
 
 	}
 
-	deviceTokens := []string{}
-	tokens := dbClient.Collection("tokens").Documents(ctx)
+	wg.Wait()
 
-	for {
+	return delivered.Load()
 
-		token, err := tokens.Next()
+}
 
-		if err == iterator.Done {
-			break
-		}
+// alertText returns the title and "<br>"-separated body of the alert for a
+// reading, shared by every channel that sends it. Configured templates take
+// precedence over the message catalog.
+func (s *Server) alertText(ambient Ambient) (title, body string) {
 
-		if err != nil {
-			return err
+	msgs := messages[s.cfg.Locale]
+	alert := alertTemperature
+
+	if ambient.Movement > 0 {
+
+		alert = alertMovement
+		title = siteTitle(ambient.source(), msgs.MovementTitle)
+		body = msgs.MovementBody
+
+	} else {
+
+		title = siteTitle(ambient.source(), msgs.AmbientTitle)
+		body = ambientBody(ambient, s.cfg, msgs)
+
+		if line := humidityAlert(ambient, s.cfg, msgs); line != "" {
+			body = line + "<br>" + body
 		}
 
-		deviceTokens = append(deviceTokens, token.Data()["token"].(string))
+	}
+
+	data := templateData{Ambient: ambient, Site: ambient.SiteID, Alert: alert}
+
+	title = renderTemplate(s.cfg.Templates, titleTemplate, data, title)
+	body = renderTemplate(s.cfg.Templates, bodyTemplate, data, body)
+
+	return
+
+}
+
+// normalizeHours returns the stored hourly slots resized to exactly 24
+// entries, dropping any extra slots and padding missing ones with zero.
+func normalizeHours(temperatures []interface{}) []interface{} {
+
+	hours := make([]interface{}, 24)
+
+	for i := range hours {
+
+		if i < len(temperatures) {
+			hours[i] = temperatures[i]
+		} else {
+			hours[i] = 0
+		}
 
 	}
 
-	_, err = fcmClient.SendMulticast(ctx, &messaging.MulticastMessage{
-		Data:    data,
-		Tokens:  deviceTokens,
-		Android: &messaging.AndroidConfig{Priority: "high"},
+	return hours
+
+}
+
+// writeTemperature stores the reading in its hourly slot and returns how
+// fast it rose since the previous one, in °C per minute.
+func (s *Server) writeTemperature(ctx context.Context, temp LogTemperature) (rate float64, err error) {
+
+	defer observeFirestore("writeTemp", time.Now())
+
+	values := s.sensorCollection(temp.SiteID, temp.SensorID, s.cfg.Collections.Temperatures).Doc("values")
+
+	hour := time.Now().In(s.cfg.Location)
+	i := hour.Hour()
+
+	// The read-modify-write runs in a transaction so concurrent writes for
+	// the same hour are serialized instead of the last one winning.
+	err = s.retryTransaction(ctx, func() error {
+
+		return s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) (err error) {
+
+			rate = 0
+			data, err := tx.Get(values)
+			exists := status.Code(err) != codes.NotFound
+
+			if err != nil && exists {
+				return
+			}
+
+			var stored []interface{}
+			var doc map[string]interface{}
+
+			if exists {
+
+				doc = data.Data()
+
+				if stored, err = storedHours(doc); err != nil {
+					return fmt.Errorf("%s/%s: %w", values.Parent.ID, values.ID, err)
+				}
+
+			}
+
+			temperatures := normalizeHours(stored)
+
+			if err = checkHourIndex(temperatures, i); err != nil {
+				return fmt.Errorf("%s/%s: %w", values.Parent.ID, values.ID, err)
+			}
+
+			adj := roundTo(temp.AdjTemperature, s.cfg.TempDecimals)
+			hourStart := hour.Truncate(time.Hour)
+			spike := isSpike(temperatures[(i+23)%24], hourStart, adj, s.cfg.TempSpikeDelta)
+
+			if spike && s.cfg.TempSpikeMode == spikeDrop {
+				return errSpike
+			}
+
+			slot := mergeHourSlot(
+				temperatures[i],
+				hourStart,
+				roundTo(temp.AvgTemperature, s.cfg.TempDecimals),
+				adj,
+			)
+			temperatures[i] = slot
+
+			if spike {
+				slot["suspect"] = true
+			}
+
+			fields := map[string]interface{}{"Temperatures": temperatures}
+
+			// The smoothed value carries over between hours in a site-level
+			// field, and is also kept in the hour's slot. A suspect value
+			// doesn't move it.
+			if s.cfg.TempEMAAlpha > 0 && !spike {
+				prev, ok := slotValue(doc, "smooth_temperature")
+				smooth := roundTo(ema(prev, ok, adj, s.cfg.TempEMAAlpha), s.cfg.TempDecimals)
+				slot["smooth_temperature"] = smooth
+				fields["smooth_temperature"] = smooth
+			}
+
+			// The rate is taken against the last reading, kept in site-level
+			// fields across hours. A suspect value neither raises nor moves it.
+			if !spike {
+
+				last, ok := slotValue(doc, "last_temperature")
+
+				if at, isTime := doc["last_reading"].(time.Time); ok && isTime {
+					rate = riseRate(last, at, adj, hour)
+				}
+
+				fields["last_temperature"] = adj
+				fields["last_reading"] = hour
+
+			}
+
+			if !exists {
+				return tx.Set(values, fields)
+			}
+
+			var updates []firestore.Update
+
+			for path, value := range fields {
+				updates = append(updates, firestore.Update{Path: path, Value: value})
+			}
+
+			return tx.Update(values, updates)
+
+		})
+
 	})
 
-	if err != nil {
-		return
+	return
+
+}
+
+// siteParam reads the required site query parameter, answering 400 itself
+// when it is missing or invalid.
+func siteParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+
+	site := r.URL.Query().Get("site")
+
+	if err := validSiteID(site); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return "", false
 	}
 
-	return nil
+	return site, true
 
 }
 
-func writeTemperature(temp LogTemperature) (err error) {
+// sensorParam reads the optional sensor query parameter, the default sensor
+// when it is absent, answering 400 itself when it is invalid.
+func sensorParam(w http.ResponseWriter, r *http.Request) (string, bool) {
 
-	ctx := context.Background()
-	app, err := firebaseApp(ctx)
+	sensor := r.URL.Query().Get("sensor")
 
-	if err != nil {
+	if sensor == "" {
+		return defaultSensor, true
+	}
+
+	if err := validSensorID(sensor); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return "", false
+	}
+
+	return sensor, true
+
+}
+
+// jsonContent reports whether the request declares a JSON body, with or
+// without a charset, answering 415 itself when it doesn't.
+func jsonContent(w http.ResponseWriter, r *http.Request) bool {
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if err != nil || mediaType != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		w.Write([]byte("Content-Type must be application/json"))
+		return false
+	}
+
+	return true
+
+}
+
+// decodeJSON decodes the request body into v, reading at most MaxBodyBytes.
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+
+	body := http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes)
+	return json.NewDecoder(body).Decode(v)
+
+}
+
+// readBody reads the whole request body, at most MaxBodyBytes.
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+
+	return io.ReadAll(http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes))
+
+}
+
+// requestContext derives the context used for the Firestore and FCM calls of
+// a request, bounded by FirestoreTimeout and cancelled if the client goes away.
+func (s *Server) requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+
+	return context.WithTimeout(r.Context(), s.cfg.FirestoreTimeout)
+
+}
+
+func isTooLarge(err error) bool {
+
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+
+}
+
+// writeAmbient appends the reading to the ambient history collection.
+func (s *Server) writeAmbient(ctx context.Context, ambient Ambient) (err error) {
+
+	defer observeFirestore("sendAll", time.Now())
+
+	// The ID is picked once so a retried write can't store the reading twice.
+	doc := s.sensorCollection(ambient.SiteID, ambient.SensorID, s.cfg.Collections.Ambient).NewDoc()
+
+	return s.retry(ctx, func() (err error) {
+		_, err = doc.Set(ctx, AmbientReading{Ambient: ambient})
+		return
+	})
+
+}
+
+func (s *Server) sendAll(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Invalid Method"))
 		return
 	}
 
-	dbClient, err := app.Firestore(ctx)
+	// Every answer says so, even the ones without a body.
+	if s.cfg.DryRun {
+		w.Header().Set("X-Dry-Run", "true")
+	}
+
+	if !jsonContent(w, r) {
+		return
+	}
+
+	body, err := s.readBody(w, r)
 
 	if err != nil {
+
+		slog.Error("read ambient", "op", "sendAll", "err", err)
+
+		if isTooLarge(err) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		return
+
+	}
+
+	// A sensor flushing readings buffered while offline sends an array.
+	if trimmed := bytes.TrimLeft(body, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '[' {
+		s.sendBatch(w, r, body)
 		return
 	}
 
-	values := dbClient.Collection("temperatures").Doc("values")
-	data, err := values.Get(ctx)
+	decoded, err := decodeAmbient(body)
+
+	if errors.Is(err, errUnknownSchema) || errors.Is(err, errUnknownField) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
 
 	if err != nil {
+		slog.Error("decode ambient", "op", "sendAll", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	temperatures := data.Data()["Temperatures"].([]interface{})
-	size := len(temperatures)
+	s.readings.add(decoded, time.Now())
+	ambient := &decoded
+
+	ambient.HeatIndex = computeHeatIndex(ambient.Temperature, ambient.Humidity)
+	ambient.DewPoint = computeDewPoint(ambient.Temperature, ambient.Humidity)
 
-	for i := 0; i < 24-size; i++ {
-		temperatures = append(temperatures, 0)
+	if err := ambient.validate(); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(err.Error()))
+		return
 	}
 
-	hour := time.Now()
-	i := hour.In(timeZone).Hour()
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	s.heartbeat(ctx, ambient.SiteID)
 
-	temperatures[i] = map[string]interface{}{
-		"avg_temperature": math.Floor(temp.AvgTemperature*100) * 0.01,
-		"adj_temperature": math.Floor(temp.AdjTemperature*100) * 0.01,
+	if err := s.writeAmbient(ctx, *ambient); err != nil {
+		slog.Error("write ambient", "op", "sendAll", "collection", s.cfg.Collections.Ambient, "err", err)
 	}
 
-	_, err = data.Ref.Update(ctx, []firestore.Update{{Path: "Temperatures", Value: temperatures}})
+	result, err := s.sendPushNotification(ctx, *ambient)
+
+	if errors.Is(err, errWithinThresholds) || errors.Is(err, errCooldown) || errors.Is(err, errDebounced) || errors.Is(err, errStale) ||
+		errors.Is(err, errQuietHours) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if errors.Is(err, errMessagingUnavailable) {
+		slog.Warn("push notification skipped", "op", "sendAll", "site", ambient.SiteID, "err", err)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
 
 	if err != nil {
+
+		slog.Error("send push notification", "op", "sendAll", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
 		return
+
 	}
 
-	return nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+
 }
 
-func sendAll(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getAmbient(w http.ResponseWriter, r *http.Request) {
 
-	if r.Method != "POST" {
-		w.WriteHeader(http.StatusBadRequest)
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
 		w.Write([]byte("Invalid Method"))
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	ambient := &Ambient{}
+	site, ok := siteParam(w, r)
 
-	if err := decoder.Decode(ambient); err != nil {
+	if !ok {
+		return
+	}
 
-		log.Println("Error:", err)
-		w.WriteHeader(http.StatusBadRequest)
+	sensor, ok := sensorParam(w, r)
+
+	if !ok {
 		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	docs, err := s.sensorCollection(site, sensor, s.cfg.Collections.Ambient).
+		OrderBy("timestamp", firestore.Desc).
+		Limit(1).
+		Documents(ctx).
+		GetAll()
 
+	if err != nil {
+		slog.Error("read ambient", "op", "getAmbient", "collection", s.cfg.Collections.Ambient, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(docs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("No readings"))
+		return
 	}
 
-	if err := sendPushNotification(*ambient); err != nil {
+	reading := AmbientReading{}
 
-		log.Println("Error:", err)
-		w.WriteHeader(http.StatusBadRequest)
+	if err = docs[0].DataTo(&reading); err != nil {
+		slog.Error("decode ambient", "op", "getAmbient", "doc", docs[0].Ref.ID, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reading)
+
+}
+
+// healthz reports whether Firestore is reachable with a single-document read.
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	_, err := s.fs.Collection(s.cfg.Collections.Sites).Limit(1).Documents(ctx).GetAll()
 
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(err.Error()))
+		return
 	}
 
+	w.Write([]byte("OK"))
+
 }
 
-func setTemperatures(w http.ResponseWriter, r *http.Request) {
+func (s *Server) setTemperatures(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method != "POST" {
 		w.WriteHeader(http.StatusBadRequest)
@@ -280,42 +1087,202 @@ func setTemperatures(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	data := LogTemperature{}
+	if !jsonContent(w, r) {
+		return
+	}
+
+	body, err := s.readBody(w, r)
+
+	if isTooLarge(err) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write([]byte("Body too large"))
+		slog.Error("decode temperature", "op", "setTemperatures", "err", err)
+		return
+	}
+
+	var data LogTemperature
 
-	err := decoder.Decode(&data)
+	if err == nil {
+		data, err = decodeLogTemperature(body)
+	}
+
+	if errors.Is(err, errUnknownSchema) || errors.Is(err, errUnknownField) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
 
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte("MIssing data"))
-		log.Println("Error Temp:", err)
+		slog.Error("decode temperature", "op", "setTemperatures", "err", err)
+		return
+	}
+
+	if err = validSiteID(data.SiteID); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(err.Error()))
 		return
 	}
 
-	if err = writeTemperature(data); err != nil {
+	if err = validSensorID(data.SensorID); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	s.heartbeat(ctx, data.SiteID)
+
+	rate, err := s.writeTemperature(ctx, data)
+
+	if errors.Is(err, errSpike) {
+		slog.Warn("temperature spike dropped", "op", "setTemperatures", "site", data.SiteID, "adj_temperature", data.AdjTemperature)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("Fail in writing temperature"))
-		log.Println("Error write Temp:", err)
+		slog.Error("write temperature", "op", "writeTemperature", "collection", s.cfg.Collections.Temperatures, "err", err)
 		return
 	}
 
+	if s.cfg.TempRiseRate > 0 && rate > s.cfg.TempRiseRate {
+		s.notifyRising(ctx, data, rate)
+	}
+
+}
+
+// listenAddr joins LISTEN_ADDR and PORT into the address to listen on. An
+// empty host binds every interface.
+func listenAddr(host, port string) (string, error) {
+
+	n, err := strconv.Atoi(port)
+
+	if err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid PORT %q", port)
+	}
+
+	addr := net.JoinHostPort(host, port)
+
+	if _, err := net.ResolveTCPAddr("tcp", addr); err != nil {
+		return "", fmt.Errorf("invalid LISTEN_ADDR %q: %w", host, err)
+	}
+
+	return addr, nil
+
 }
 
 func main() {
 
+	if err := setupLogging(os.Getenv("LOG_LEVEL")); err != nil {
+		slog.Error("setup logging", "err", err)
+		os.Exit(1)
+	}
+
 	port := os.Getenv("PORT")
 
 	if port == "" {
 		port = "8000"
 	}
 
-	http.HandleFunc("/sendAll", sendAll)
-	http.HandleFunc("/writeTemp", setTemperatures)
+	addr, err := listenAddr(os.Getenv("LISTEN_ADDR"), port)
 
-	fmt.Printf("Running in %s...\n", port)
+	if err != nil {
+		slog.Error("listen address", "err", err)
+		os.Exit(1)
+	}
 
-	log.Fatal(
-		http.ListenAndServe(fmt.Sprintf(":%s", port), nil),
-	)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv, err := newServer(ctx)
+
+	if err != nil {
+		slog.Error("create server", "err", err)
+		os.Exit(1)
+	}
+
+	defer srv.Close()
+
+	if srv.cfg.APIKey == "" {
+		slog.Warn("API_KEY not set, ingest endpoints are unauthenticated")
+	}
+
+	if srv.cfg.DryRun {
+		slog.Warn("DRY_RUN set, push notifications are logged instead of sent")
+	}
+
+	if srv.limiter != nil {
+		go srv.limiter.evictIdle(ctx, time.Minute)
+	}
+
+	http.HandleFunc("/sendAll", countRequests(sendAllRequests, srv.rateLimit(srv.requireAPIKey(srv.idempotent(srv.sendAll)))))
+	http.HandleFunc("/writeTemp", countRequests(writeTempRequests, srv.rateLimit(srv.requireAPIKey(srv.idempotent(srv.setTemperatures)))))
+	http.HandleFunc("/ambient", srv.cors(compress(srv.getAmbient)))
+	http.HandleFunc("/alerts/latest", srv.cors(compress(srv.getLatestAlerts)))
+	http.HandleFunc("/healthz", srv.healthz)
+	http.HandleFunc("/version", getVersion)
+	http.HandleFunc("/tokens", srv.tokens)
+	http.HandleFunc("/tokens/bulk", srv.requireAPIKey(srv.bulkTokens))
+	http.HandleFunc("/dailySummary", srv.requireAPIKey(srv.dailySummary))
+	http.HandleFunc("/temperatures", srv.cors(compress(srv.getTemperatures)))
+	http.HandleFunc("/temperatures.csv", srv.cors(compress(srv.getTemperaturesCSV)))
+	http.HandleFunc("/stream", srv.cors(srv.stream))
+	http.HandleFunc("/movement", srv.cors(compress(srv.getMovement)))
+	http.HandleFunc("/movementSummary", srv.cors(srv.getMovementSummary))
+	http.HandleFunc("/compute", srv.compute)
+	http.HandleFunc("/config", srv.requireAPIKey(srv.getConfig))
+	http.HandleFunc("/checkSensors", srv.requireAPIKey(srv.checkSensors))
+	http.HandleFunc("/recompute", srv.requireAPIKey(srv.recompute))
+	http.HandleFunc("/rollup", srv.requireAPIKey(srv.rollup))
+	http.HandleFunc("/sweep", srv.requireAPIKey(srv.sweep))
+	http.HandleFunc("/simulate", srv.requireAPIKey(srv.simulate))
+	http.Handle("/metrics", promhttp.Handler())
+
+	if srv.cfg.DebugEndpoints {
+		slog.Warn("DEBUG_ENDPOINTS set, serving /debug/readings")
+		http.HandleFunc("/debug/readings", srv.requireAPIKey(srv.getDebugReadings))
+	}
+
+	httpServer := &http.Server{Addr: addr, Handler: logRequests(http.DefaultServeMux)}
+	serveErr := make(chan error, 1)
+
+	go func() {
+
+		if srv.cfg.TLS() {
+			serveErr <- httpServer.ListenAndServeTLS(srv.cfg.TLSCertFile, srv.cfg.TLSKeyFile)
+		} else {
+			serveErr <- httpServer.ListenAndServe()
+		}
+
+	}()
+
+	slog.Info("running", "addr", addr, "tls", srv.cfg.TLS(), "version", version, "commit", commit)
+
+	select {
+
+	case err = <-serveErr:
+		slog.Error("listen", "addr", httpServer.Addr, "err", err)
+		srv.Close()
+		os.Exit(1)
+
+	case <-ctx.Done():
+
+	}
+
+	slog.Info("shutting down", "grace", srv.cfg.ShutdownGrace.String())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), srv.cfg.ShutdownGrace)
+	defer cancel()
+
+	if err = httpServer.Shutdown(shutdownCtx); err != nil {
+		slog.Error("shutdown", "err", err)
+	}
 
 }
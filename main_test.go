@@ -0,0 +1,738 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+func TestNormalizeHours(t *testing.T) {
+
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"short", 5},
+		{"exact", 24},
+		{"long", 30},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			stored := make([]interface{}, tt.size)
+
+			for i := range stored {
+				stored[i] = i + 1
+			}
+
+			hours := normalizeHours(stored)
+
+			if len(hours) != 24 {
+				t.Fatalf("len = %d, want 24", len(hours))
+			}
+
+			for i, v := range hours {
+
+				want := interface{}(0)
+
+				if i < tt.size {
+					want = i + 1
+				}
+
+				if v != want {
+					t.Errorf("hours[%d] = %v, want %v", i, v, want)
+				}
+
+			}
+
+		})
+
+	}
+
+}
+
+func TestOversizedBody(t *testing.T) {
+
+	s := &Server{cfg: Config{MaxBodyBytes: 64}}
+	body := `{"temperature": 25, "humidity": ` + strings.Repeat(" ", 128) + `50}`
+
+	handlers := map[string]http.HandlerFunc{
+		"/sendAll":   s.sendAll,
+		"/writeTemp": s.setTemperatures,
+	}
+
+	for path, handler := range handlers {
+
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		handler(w, r)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: status = %d, want %d", path, w.Code, http.StatusRequestEntityTooLarge)
+		}
+
+	}
+
+}
+
+// newTestServer returns a Server backed by the Firestore emulator, skipping
+// the test when FIRESTORE_EMULATOR_HOST is not set.
+func newTestServer(t *testing.T) *Server {
+
+	t.Helper()
+
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST not set")
+	}
+
+	fs, err := firestore.NewClient(context.Background(), emulatorProjectID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { fs.Close() })
+
+	return &Server{
+		cfg: Config{
+			Cooldown:          time.Minute,
+			Location:          defaultTimeZone,
+			MaxBodyBytes:      64 << 10,
+			FirestoreTimeout:  10 * time.Second,
+			FirestoreAttempts: 3,
+			TempUnit:          "C",
+			TempDecimals:      2,
+			Locale:            "es",
+			Collections:       loadCollections(),
+			MovementRetention: 7,
+		},
+		fs:           fs,
+		lastSent:     map[string]time.Time{},
+		lastMovement: map[string]time.Time{},
+	}
+
+}
+
+func clearCollection(t *testing.T, collection *firestore.CollectionRef) {
+
+	t.Helper()
+
+	docs, err := collection.Documents(context.Background()).GetAll()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, doc := range docs {
+
+		if _, err := doc.Ref.Delete(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+	}
+
+}
+
+func TestFirebaseAppEmulator(t *testing.T) {
+
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "localhost:8080")
+	t.Setenv("FILENAME_CREDENTIALS", "")
+
+	app, err := firebaseApp(context.Background(), loadCredentials("FIRESTORE_CREDENTIALS"))
+
+	if err != nil {
+		t.Fatalf("firebaseApp() error = %v", err)
+	}
+
+	fs, err := app.Firestore(context.Background())
+
+	if err != nil {
+		t.Fatalf("Firestore() error = %v", err)
+	}
+
+	fs.Close()
+
+}
+
+func TestSendAllMovement(t *testing.T) {
+
+	s := newTestServer(t)
+	fcm := &fakeNotifier{}
+	s.fcm = fcm
+
+	ctx := context.Background()
+	site := "test-site"
+	movement := s.collection(site, s.cfg.Collections.Movement)
+	tokens := s.tokenCollection(site)
+
+	clearCollection(t, movement)
+	clearCollection(t, tokens)
+	t.Cleanup(func() {
+		clearCollection(t, movement)
+		clearCollection(t, tokens)
+	})
+
+	if _, err := tokens.Doc("tok-1").Set(ctx, map[string]interface{}{"token": "tok-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(s.sendAll))
+	defer srv.Close()
+
+	body := `{"siteId":"test-site","temperature":22,"humidity":50,"move":1}`
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var result SendResult
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Sent != 1 || len(fcm.multicasts) != 1 {
+		t.Errorf("sent = %d with %d multicasts, want 1 and 1", result.Sent, len(fcm.multicasts))
+	}
+
+	snapshot, err := movement.Doc(movementDocID(time.Now().In(s.cfg.Location))).Get(ctx)
+
+	if err != nil {
+		t.Fatalf("movement doc: %v", err)
+	}
+
+	var day struct {
+		MoveLogs []MoveLog `firestore:"move_logs"`
+	}
+
+	if err := snapshot.DataTo(&day); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(day.MoveLogs) != 1 {
+		t.Errorf("move_logs = %d entries, want 1", len(day.MoveLogs))
+	}
+
+}
+
+func TestListenAddr(t *testing.T) {
+
+	tests := []struct {
+		host    string
+		port    string
+		want    string
+		wantErr bool
+	}{
+		{"", "8000", ":8000", false},
+		{"127.0.0.1", "8000", "127.0.0.1:8000", false},
+		{"::1", "9000", "[::1]:9000", false},
+		{"", "http", "", true},
+		{"", "70000", "", true},
+		{"", "0", "", true},
+		{"127.0.0.1:80", "8000", "", true},
+	}
+
+	for _, tt := range tests {
+
+		got, err := listenAddr(tt.host, tt.port)
+
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("listenAddr(%q, %q) = %q, %v; want %q, error %v", tt.host, tt.port, got, err, tt.want, tt.wantErr)
+		}
+
+	}
+
+}
+
+func TestSendAllHighTemperature(t *testing.T) {
+
+	s := newTestServer(t)
+	fcm := &fakeNotifier{}
+	s.fcm = fcm
+	s.cfg.TempMax = 30
+	s.cfg.HeatIndexMax = 40
+	s.cfg.HumidityMax = 70
+	s.cfg.UseTopic = true
+	s.cfg.TopicName = "alerts"
+
+	ambient := s.collection("test-site", s.cfg.Collections.Ambient)
+	clearCollection(t, ambient)
+	t.Cleanup(func() { clearCollection(t, ambient) })
+
+	srv := httptest.NewServer(http.HandlerFunc(s.sendAll))
+	defer srv.Close()
+
+	// The computed heat index here is above 100°C.
+	body := `{"siteId":"test-site","temperature":55,"humidity":40}`
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	if len(fcm.sent) != 1 {
+		t.Errorf("sent %d alerts, want 1", len(fcm.sent))
+	}
+
+}
+
+func TestSendAllWithoutMessaging(t *testing.T) {
+
+	s := newTestServer(t)
+	s.cfg.TempMax = 30
+	s.cfg.HeatIndexMax = 40
+	s.cfg.HumidityMax = 70
+
+	ambient := s.collection("test-site", s.cfg.Collections.Ambient)
+	clearCollection(t, ambient)
+	t.Cleanup(func() { clearCollection(t, ambient) })
+
+	srv := httptest.NewServer(http.HandlerFunc(s.sendAll))
+	defer srv.Close()
+
+	body := `{"siteId":"test-site","temperature":35,"humidity":40}`
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+
+	docs, err := ambient.Documents(context.Background()).GetAll()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(docs) != 1 {
+		t.Errorf("%d ambient docs logged, want 1", len(docs))
+	}
+
+}
+
+func TestFormatClock(t *testing.T) {
+
+	tests := []struct {
+		at   time.Time
+		mode string
+		want string
+	}{
+		{time.Date(2023, 5, 4, 12, 0, 0, 0, time.UTC), clock12h, "12:00:00PM"},
+		{time.Date(2023, 5, 4, 0, 0, 0, 0, time.UTC), clock12h, "12:00:00AM"},
+		{time.Date(2023, 5, 4, 15, 4, 5, 0, time.UTC), clock12h, "3:04:05PM"},
+		{time.Date(2023, 5, 4, 9, 5, 7, 0, time.UTC), clock12h, "9:05:07AM"},
+		{time.Date(2023, 5, 4, 10, 5, 7, 0, time.UTC), clock12h, "10:05:07AM"},
+		{time.Date(2023, 5, 4, 12, 0, 0, 0, time.UTC), clock24h, "12:00:00"},
+		{time.Date(2023, 5, 4, 0, 0, 0, 0, time.UTC), clock24h, "00:00:00"},
+		{time.Date(2023, 5, 4, 15, 4, 5, 0, time.UTC), clock24h, "15:04:05"},
+	}
+
+	for _, tt := range tests {
+
+		if got := formatClock(tt.at, tt.mode); got != tt.want {
+			t.Errorf("formatClock(%s, %s) = %q, want %q", tt.at.Format(time.TimeOnly), tt.mode, got, tt.want)
+		}
+
+	}
+
+}
+
+func TestStale(t *testing.T) {
+
+	cfg := Config{MaxReadingAge: 5 * time.Minute}
+	now := time.Now()
+	fresh := now.Add(-time.Minute)
+	old := now.Add(-10 * time.Minute)
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		ambient Ambient
+		want    bool
+	}{
+		{"fresh", cfg, Ambient{SensorTime: &fresh}, false},
+		{"stale", cfg, Ambient{SensorTime: &old}, true},
+		{"missing", cfg, Ambient{}, false},
+		{"disabled", Config{}, Ambient{SensorTime: &old}, false},
+	}
+
+	for _, tt := range tests {
+
+		if got := tt.cfg.stale(tt.ambient, now); got != tt.want {
+			t.Errorf("%s: stale() = %v, want %v", tt.name, got, tt.want)
+		}
+
+	}
+
+}
+
+func TestSendAlertStale(t *testing.T) {
+
+	old := time.Now().Add(-10 * time.Minute)
+	fresh := time.Now()
+
+	tests := []struct {
+		name       string
+		sensorTime *time.Time
+		wantErr    error
+	}{
+		{"stale", &old, errStale},
+		{"fresh", &fresh, nil},
+		{"missing", nil, nil},
+	}
+
+	for _, tt := range tests {
+
+		fcm := &fakeNotifier{}
+		s := &Server{
+			cfg: Config{
+				TempMax:       30,
+				HeatIndexMax:  40,
+				HumidityMax:   70,
+				MaxReadingAge: 5 * time.Minute,
+				Cooldown:      time.Minute,
+				Location:      defaultTimeZone,
+				TempUnit:      "C",
+				Locale:        "es",
+				UseTopic:      true,
+				TopicName:     "alerts",
+			},
+			fcm:      fcm,
+			lastSent: map[string]time.Time{},
+		}
+
+		ambient := Ambient{SiteID: "room-1", Temperature: 35, Humidity: 40, HeatIndex: 36, SensorTime: tt.sensorTime}
+		_, err := s.sendAlert(context.Background(), ambient)
+
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: sendAlert() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+
+		if wantSent := tt.wantErr == nil; (len(fcm.sent) == 1) != wantSent {
+			t.Errorf("%s: %d alerts sent", tt.name, len(fcm.sent))
+		}
+
+	}
+
+}
+
+func TestInQuietHours(t *testing.T) {
+
+	at := func(hour, minute int) time.Time {
+		return time.Date(2023, 5, 4, hour, minute, 0, 0, defaultTimeZone)
+	}
+
+	daytime := Config{Location: defaultTimeZone, QuietStart: 13 * time.Hour, QuietEnd: 15 * time.Hour}
+	overnight := Config{Location: defaultTimeZone, QuietStart: 22 * time.Hour, QuietEnd: 6*time.Hour + 30*time.Minute}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		at   time.Time
+		want bool
+	}{
+		{"in window", daytime, at(14, 0), true},
+		{"window start", daytime, at(13, 0), true},
+		{"window end", daytime, at(15, 0), false},
+		{"out of window", daytime, at(9, 0), false},
+		{"wrap before midnight", overnight, at(23, 15), true},
+		{"wrap after midnight", overnight, at(3, 0), true},
+		{"wrap end", overnight, at(6, 30), false},
+		{"wrap out of window", overnight, at(12, 0), false},
+		{"disabled", Config{Location: defaultTimeZone}, at(3, 0), false},
+	}
+
+	for _, tt := range tests {
+
+		if got := tt.cfg.inQuietHours(tt.at); got != tt.want {
+			t.Errorf("%s: inQuietHours() = %v, want %v", tt.name, got, tt.want)
+		}
+
+	}
+
+}
+
+func TestSendAlertQuietHours(t *testing.T) {
+
+	now := time.Now().In(defaultTimeZone)
+	offset := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		ambient Ambient
+		wantErr error
+	}{
+		{"warning", Ambient{SiteID: "room-1", Temperature: 31, Humidity: 40, HeatIndex: 32}, errQuietHours},
+		{"critical", Ambient{SiteID: "room-1", Temperature: 36, Humidity: 40, HeatIndex: 37}, nil},
+		{"movement", Ambient{SiteID: "room-1", Temperature: 20, Humidity: 40, HeatIndex: 20, Movement: 1}, nil},
+	}
+
+	for _, tt := range tests {
+
+		fcm := &fakeNotifier{}
+		s := &Server{
+			cfg: Config{
+				TempMax:      30,
+				HeatIndexMax: 40,
+				HumidityMax:  70,
+				QuietStart:   (offset - time.Hour + day) % day,
+				QuietEnd:     (offset + time.Hour) % day,
+				Cooldown:     time.Minute,
+				Location:     defaultTimeZone,
+				TempUnit:     "C",
+				Locale:       "es",
+				UseTopic:     true,
+				TopicName:    "alerts",
+			},
+			fcm:      fcm,
+			lastSent: map[string]time.Time{},
+		}
+
+		if _, err := s.sendAlert(context.Background(), tt.ambient); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: sendAlert() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+
+	}
+
+}
+
+func TestSendAlertCooldownPerSensor(t *testing.T) {
+
+	fcm := &fakeNotifier{}
+	s := &Server{
+		cfg: Config{
+			TempMax:      30,
+			HeatIndexMax: 40,
+			HumidityMax:  70,
+			Cooldown:     time.Minute,
+			Location:     defaultTimeZone,
+			TempUnit:     "C",
+			Locale:       "es",
+			UseTopic:     true,
+			TopicName:    "alerts",
+		},
+		fcm:      fcm,
+		lastSent: map[string]time.Time{},
+	}
+
+	hot := Ambient{SiteID: "room-1", Temperature: 36, Humidity: 40, HeatIndex: 37}
+	rack := hot
+	rack.SensorID = "rack-2"
+
+	if _, err := s.sendAlert(context.Background(), hot); err != nil {
+		t.Fatalf("default sensor: sendAlert() = %v", err)
+	}
+
+	// One sensor's cooldown doesn't hold back another's alert at the site.
+	if _, err := s.sendAlert(context.Background(), rack); err != nil {
+		t.Errorf("rack-2: sendAlert() = %v, want it sent", err)
+	}
+
+	if _, err := s.sendAlert(context.Background(), rack); !errors.Is(err, errCooldown) {
+		t.Errorf("rack-2 again: sendAlert() = %v, want %v", err, errCooldown)
+	}
+
+	if len(fcm.sent) != 2 {
+		t.Errorf("%d alerts sent, want 2", len(fcm.sent))
+	}
+
+}
+
+func TestLoadCredentials(t *testing.T) {
+
+	t.Setenv("FILENAME_CREDENTIALS", "shared.json")
+	t.Setenv("GOOGLE_CREDENTIALS_JSON", "")
+	t.Setenv("FIRESTORE_CREDENTIALS", "")
+	t.Setenv("FCM_CREDENTIALS", "push.json")
+
+	if got := loadCredentials("FIRESTORE_CREDENTIALS"); got.file != "shared.json" {
+		t.Errorf("Firestore credentials = %+v, want the shared fallback", got)
+	}
+
+	if got := loadCredentials("FCM_CREDENTIALS"); got.file != "push.json" {
+		t.Errorf("FCM credentials = %+v, want push.json", got)
+	}
+
+	t.Setenv("GOOGLE_CREDENTIALS_JSON", `{"type":"service_account"}`)
+
+	if got := loadCredentials("FIRESTORE_CREDENTIALS"); got.json == "" || got.file != "" {
+		t.Errorf("Firestore credentials = %+v, want the JSON over FILENAME_CREDENTIALS", got)
+	}
+
+	if got := loadCredentials("FCM_CREDENTIALS"); got.file != "push.json" {
+		t.Errorf("FCM credentials = %+v, want push.json over the JSON", got)
+	}
+
+}
+
+func TestFirebaseAppCredentials(t *testing.T) {
+
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "")
+
+	if _, err := firebaseApp(context.Background(), credentials{}); !errors.Is(err, errNoCredentials) {
+		t.Errorf("firebaseApp() without credentials error = %v, want errNoCredentials", err)
+	}
+
+	if _, err := firebaseApp(context.Background(), credentials{json: "{not json"}); err == nil {
+		t.Error("firebaseApp() accepted malformed GOOGLE_CREDENTIALS_JSON")
+	}
+
+}
+
+// serviceAccountFile writes a service account key file that clients accept
+// without reaching Google, as long as nothing is sent with it.
+func serviceAccountFile(t *testing.T) string {
+
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   emulatorProjectID,
+		"client_email": "monitor@" + emulatorProjectID + ".iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	})
+
+	file := filepath.Join(t.TempDir(), "store.json")
+
+	if err := os.WriteFile(file, account, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+
+}
+
+func TestNewServerBadPushCredentials(t *testing.T) {
+
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "")
+	t.Setenv("FIRESTORE_CREDENTIALS", serviceAccountFile(t))
+	t.Setenv("FCM_CREDENTIALS", "")
+	t.Setenv("GOOGLE_CREDENTIALS_JSON", "{not json")
+
+	// Push then has credentials of its own, and broken ones only disable it.
+	s, err := newServer(context.Background())
+
+	if err != nil {
+		t.Fatalf("newServer() error = %v, want push disabled", err)
+	}
+
+	defer s.Close()
+
+	if s.fcm != nil {
+		t.Error("fcm set from unusable push credentials")
+	}
+
+}
+
+func TestIngestContentType(t *testing.T) {
+
+	s := &Server{cfg: Config{MaxBodyBytes: 64}}
+
+	handlers := map[string]http.HandlerFunc{
+		"/sendAll":   s.sendAll,
+		"/writeTemp": s.setTemperatures,
+	}
+
+	tests := []struct {
+		contentType string
+		want        int
+	}{
+		{"", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"text/plain; charset=utf-8", http.StatusUnsupportedMediaType},
+		{"application/json; charset=utf-8", http.StatusBadRequest},
+	}
+
+	for path, handler := range handlers {
+
+		for _, tt := range tests {
+
+			r := httptest.NewRequest("POST", path, strings.NewReader("temperature=25"))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			handler(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("%s with %q: status = %d, want %d", path, tt.contentType, w.Code, tt.want)
+			}
+
+		}
+
+	}
+
+}
+
+func TestIngestUnknownField(t *testing.T) {
+
+	s := &Server{cfg: Config{MaxBodyBytes: 1 << 10}}
+
+	handlers := map[string]http.HandlerFunc{
+		"/sendAll":   s.sendAll,
+		"/writeTemp": s.setTemperatures,
+	}
+
+	for path, handler := range handlers {
+
+		r := httptest.NewRequest("POST", path, strings.NewReader(`{"siteId":"test-site","temperatur":25}`))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		handler(w, r)
+
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"temperatur"`) {
+			t.Errorf("%s: got %d %q, want 400 naming the field", path, w.Code, w.Body.String())
+		}
+
+	}
+
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// messageSet holds the user-facing notification strings for one locale.
+type messageSet struct {
+	AmbientTitle   string
+	TemperatureLbl string
+	HumidityLbl    string
+	HeatIndexLbl   string
+	NotApplicable  string
+	DewPointLbl    string
+	HumidityHigh   string
+	HumidityLow    string
+
+	MovementTitle string
+	MovementBody  string
+
+	SummaryTitle string
+	MinLbl       string
+	MaxLbl       string
+	AvgLbl       string
+	MovesLbl     string
+	NoReadings   string
+
+	SensorOfflineTitle string
+	SensorOfflineBody  string
+
+	RisingTitle string
+	RisingBody  string
+}
+
+// messages is the notification catalog keyed by NOTIFICATION_LOCALE.
+var messages = map[string]messageSet{
+	"es": {
+		AmbientTitle:   "Alerta de Ambiente",
+		TemperatureLbl: "Temperatura",
+		HumidityLbl:    "Humedad",
+		HeatIndexLbl:   "Indice de Calor",
+		NotApplicable:  "N/A",
+		DewPointLbl:    "Punto de Rocío",
+		HumidityHigh:   "Humedad alta",
+		HumidityLow:    "Humedad baja",
+		MovementTitle:  "¡Alguien ha entrado al site!",
+		MovementBody:   "Se han detectado lecturas de movimiento.",
+		SummaryTitle:   "Resumen Diario",
+		MinLbl:         "Mínima",
+		MaxLbl:         "Máxima",
+		AvgLbl:         "Promedio",
+		MovesLbl:       "Movimientos",
+		NoReadings:     "Sin lecturas de temperatura",
+
+		SensorOfflineTitle: "Sensor sin conexión",
+		SensorOfflineBody:  "El sensor no reporta desde hace %d minutos.",
+
+		RisingTitle: "La temperatura sube rápidamente",
+		RisingBody:  "La temperatura sube %s por minuto (ahora %s).",
+	},
+	"en": {
+		AmbientTitle:   "Ambient Alert",
+		TemperatureLbl: "Temperature",
+		HumidityLbl:    "Humidity",
+		HeatIndexLbl:   "Heat Index",
+		NotApplicable:  "N/A",
+		DewPointLbl:    "Dew Point",
+		HumidityHigh:   "High humidity",
+		HumidityLow:    "Low humidity",
+		MovementTitle:  "Someone has entered the site!",
+		MovementBody:   "Movement readings have been detected.",
+		SummaryTitle:   "Daily Summary",
+		MinLbl:         "Min",
+		MaxLbl:         "Max",
+		AvgLbl:         "Average",
+		MovesLbl:       "Movements",
+		NoReadings:     "No temperature readings",
+
+		SensorOfflineTitle: "Sensor offline",
+		SensorOfflineBody:  "The sensor hasn't reported for %d minutes.",
+
+		RisingTitle: "Temperature rising rapidly",
+		RisingBody:  "The temperature is rising %s per minute (now %s).",
+	},
+}
+
+// siteTitle prefixes a notification title with the site it refers to.
+func siteTitle(site, title string) string {
+
+	return fmt.Sprintf("[%s] %s", site, title)
+
+}
+
+// HeatIndexDisplay values.
+const (
+	heatIndexOmit   = "omit"
+	heatIndexNA     = "na"
+	heatIndexAlways = "always"
+)
+
+// ambientBody renders the ambient notification body, one "<br>"-separated
+// line per reading.
+func ambientBody(ambient Ambient, c Config, msgs messageSet) string {
+
+	lines := []string{
+		fmt.Sprintf("%s: %s", msgs.TemperatureLbl, formatTemperature(ambient.Temperature, c.TempUnit)),
+		fmt.Sprintf("%s: %.0f%%", msgs.HumidityLbl, ambient.Humidity),
+	}
+
+	if value := heatIndexValue(ambient, c, msgs); value != "" {
+		lines = append(lines, fmt.Sprintf("%s: %s", msgs.HeatIndexLbl, value))
+	}
+
+	lines = append(lines, fmt.Sprintf("%s: %s", msgs.DewPointLbl, formatTemperature(ambient.DewPoint, c.TempUnit)))
+
+	return strings.Join(lines, "<br>")
+
+}
+
+// heatIndexValue renders the heat index of a reading, or "" when it should
+// be left out. Outside the range it applies to, HeatIndexDisplay decides
+// whether it is left out, shown as N/A or shown anyway.
+func heatIndexValue(ambient Ambient, c Config, msgs messageSet) string {
+
+	if c.HeatIndexDisplay == heatIndexAlways || heatIndexApplies(ambient.Temperature, ambient.Humidity) {
+		return formatTemperature(ambient.HeatIndex, c.TempUnit)
+	}
+
+	if c.HeatIndexDisplay == heatIndexNA {
+		return msgs.NotApplicable
+	}
+
+	return ""
+
+}
+
+// humidityAlert returns the emphasized line that leads an ambient alert when
+// humidity is outside the configured band, or "" when it is within it.
+func humidityAlert(ambient Ambient, c Config, msgs messageSet) string {
+
+	switch {
+	case ambient.Humidity > c.HumidityMax:
+		return fmt.Sprintf("⚠ %s: %.0f%%", msgs.HumidityHigh, ambient.Humidity)
+	case ambient.Humidity < c.HumidityMin:
+		return fmt.Sprintf("⚠ %s: %.0f%%", msgs.HumidityLow, ambient.Humidity)
+	}
+
+	return ""
+
+}
+
+// summaryBody renders the daily summary notification body.
+func summaryBody(summary TemperatureSummary, moves int, msgs messageSet, unit string) string {
+
+	lines := []string{msgs.NoReadings}
+
+	if summary.Samples > 0 {
+		lines = []string{
+			fmt.Sprintf("%s: %s", msgs.MinLbl, formatTemperature(summary.Min, unit)),
+			fmt.Sprintf("%s: %s", msgs.MaxLbl, formatTemperature(summary.Max, unit)),
+			fmt.Sprintf("%s: %s", msgs.AvgLbl, formatTemperature(summary.Avg, unit)),
+		}
+	}
+
+	lines = append(lines, fmt.Sprintf("%s: %d", msgs.MovesLbl, moves))
+
+	return strings.Join(lines, "<br>")
+
+}
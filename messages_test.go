@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+func TestAmbientBody(t *testing.T) {
+
+	ambient := Ambient{Temperature: 31.456, Humidity: 55.4, HeatIndex: 33.1, DewPoint: 21.2}
+
+	tests := []struct {
+		locale string
+		unit   string
+		want   string
+	}{
+		{"es", "C", "Temperatura: 31.46°C<br>Humedad: 55%<br>Indice de Calor: 33.10°C<br>Punto de Rocío: 21.20°C"},
+		{"en", "C", "Temperature: 31.46°C<br>Humidity: 55%<br>Heat Index: 33.10°C<br>Dew Point: 21.20°C"},
+		{"en", "F", "Temperature: 88.62°F<br>Humidity: 55%<br>Heat Index: 91.58°F<br>Dew Point: 70.16°F"},
+	}
+
+	for _, tt := range tests {
+
+		if got := ambientBody(ambient, Config{TempUnit: tt.unit}, messages[tt.locale]); got != tt.want {
+			t.Errorf("ambientBody(%s, %s) = %q, want %q", tt.locale, tt.unit, got, tt.want)
+		}
+
+	}
+
+}
+
+func TestAmbientBodyHeatIndexRange(t *testing.T) {
+
+	mild := Ambient{Temperature: 22, Humidity: 30, HeatIndex: 21.4, DewPoint: 3.7}
+
+	tests := []struct {
+		display string
+		want    string
+	}{
+		{heatIndexOmit, "Temperature: 22.00°C<br>Humidity: 30%<br>Dew Point: 3.70°C"},
+		{heatIndexNA, "Temperature: 22.00°C<br>Humidity: 30%<br>Heat Index: N/A<br>Dew Point: 3.70°C"},
+		{heatIndexAlways, "Temperature: 22.00°C<br>Humidity: 30%<br>Heat Index: 21.40°C<br>Dew Point: 3.70°C"},
+	}
+
+	for _, tt := range tests {
+
+		c := Config{TempUnit: "C", HeatIndexDisplay: tt.display}
+
+		if got := ambientBody(mild, c, messages["en"]); got != tt.want {
+			t.Errorf("ambientBody(%s) = %q, want %q", tt.display, got, tt.want)
+		}
+
+	}
+
+	// Hot but dry is still outside the range.
+	if heatIndexApplies(35, 20) || !heatIndexApplies(27, 40) {
+		t.Error("heatIndexApplies() range is wrong")
+	}
+
+}
+
+func TestHumidityAlert(t *testing.T) {
+
+	cfg := Config{HumidityMax: 70, HumidityMin: 20}
+
+	tests := []struct {
+		humidity float64
+		locale   string
+		want     string
+	}{
+		{82.4, "es", "⚠ Humedad alta: 82%"},
+		{82.4, "en", "⚠ High humidity: 82%"},
+		{12, "en", "⚠ Low humidity: 12%"},
+		{70, "en", ""},
+		{20, "en", ""},
+		{45, "es", ""},
+	}
+
+	for _, tt := range tests {
+
+		if got := humidityAlert(Ambient{Humidity: tt.humidity}, cfg, messages[tt.locale]); got != tt.want {
+			t.Errorf("humidityAlert(%v, %s) = %q, want %q", tt.humidity, tt.locale, got, tt.want)
+		}
+
+	}
+
+}
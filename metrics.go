@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	sendAllRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sendall_requests_total",
+		Help: "Requests to /sendAll by response status.",
+	}, []string{"status"})
+
+	writeTempRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "writetemp_requests_total",
+		Help: "Requests to /writeTemp by response status.",
+	}, []string{"status"})
+
+	notificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notifications_sent_total",
+		Help: "Push notifications accepted by FCM.",
+	})
+
+	notificationsFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notifications_failed_total",
+		Help: "Push notifications FCM failed to deliver.",
+	})
+
+	firestoreLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "firestore_call_duration_seconds",
+		Help:    "Latency of the Firestore work done by each handler.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"handler"})
+)
+
+func init() {
+
+	prometheus.MustRegister(
+		sendAllRequests,
+		writeTempRequests,
+		notificationsSent,
+		notificationsFailed,
+		firestoreLatency,
+	)
+
+}
+
+// observeFirestore records the time since start as Firestore latency for the
+// handler. Use it as defer observeFirestore("sendAll", time.Now()).
+func observeFirestore(handler string, start time.Time) {
+
+	firestoreLatency.WithLabelValues(handler).Observe(time.Since(start).Seconds())
+
+}
+
+// statusRecorder remembers the status code written by a handler. Only the
+// first status counts, as with net/http, and a Write without a WriteHeader
+// leaves the default 200.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(code)
+
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+
+}
+
+// Flush lets streaming handlers such as /stream flush through the recorder.
+func (r *statusRecorder) Flush() {
+
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+}
+
+// countRequests increments counter, labelled with the response status, for
+// every request served by next.
+func countRequests(counter *prometheus.CounterVec, next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		counter.WithLabelValues(strconv.Itoa(rec.status)).Inc()
+
+	}
+
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MoveLog is a single movement event in a day's move_logs array. At keeps
+// the exact time for querying while Display is the clock string shown in
+// the app.
+type MoveLog struct {
+	At      time.Time `json:"at" firestore:"at"`
+	Display string    `json:"display" firestore:"display"`
+}
+
+// movementDocID returns the ID of the movement document for t's day.
+func movementDocID(t time.Time) string {
+
+	year, month, day := t.Date()
+	return fmt.Sprintf("%d-%d-%d", year, month, day)
+
+}
+
+// validMovementDocID reports whether id is a movement document ID as
+// movementDocID writes it, a real day without zero padding.
+func validMovementDocID(id string) bool {
+
+	t, err := time.Parse("2006-1-2", id)
+	return err == nil && movementDocID(t) == id
+
+}
+
+// debounceMovement reports whether a movement at now follows the site's last
+// logged movement of the same day by less than the debounce window. When it
+// doesn't, now becomes the site's last movement.
+func (s *Server) debounceMovement(site string, now time.Time) bool {
+
+	s.moveMu.Lock()
+	defer s.moveMu.Unlock()
+
+	last, ok := s.lastMovement[site]
+
+	if ok && movementDocID(last.In(s.cfg.Location)) == movementDocID(now.In(s.cfg.Location)) &&
+		now.Sub(last) < s.cfg.MovementDebounce {
+		return true
+	}
+
+	s.lastMovement[site] = now
+	return false
+
+}
+
+// logMovement appends a movement event to the current day's document,
+// keeping at most MovementRetention day documents in the collection. Day
+// documents carry a date field with the start of the day so the oldest can be
+// found by ordering on it; their IDs don't sort as dates. Failures are logged
+// rather than returned so they never block the notification.
+func (s *Server) logMovement(ctx context.Context, site string, now time.Time) {
+
+	defer observeFirestore("sendAll", time.Now())
+
+	t := now.In(s.cfg.Location)
+	entry := MoveLog{At: t, Display: formatClock(t, s.cfg.TimeFormat)}
+	collection := s.collection(site, s.cfg.Collections.Movement)
+
+	var docs []*firestore.DocumentSnapshot
+
+	err := s.retry(ctx, func() (err error) {
+		docs, err = collection.OrderBy("date", firestore.Asc).Documents(ctx).GetAll()
+		return
+	})
+
+	if err != nil {
+		slog.Error("list movement docs", "op", "logMovement", "collection", s.cfg.Collections.Movement, "err", err)
+	}
+
+	// Leave room for today's doc so at most MovementRetention days are kept.
+	// Today's doc may already exist, so it is not counted against the others.
+	today := movementDocID(t)
+	var older []*firestore.DocumentRef
+
+	for _, d := range docs {
+
+		if d.Ref.ID != today {
+			older = append(older, d.Ref)
+		}
+
+	}
+
+	excess := len(older) - s.cfg.MovementRetention + 1
+
+	for i := 0; i < excess; i++ {
+
+		old := older[i]
+
+		err = s.retry(ctx, func() (err error) {
+			_, err = old.Delete(ctx)
+			return
+		})
+
+		if err != nil {
+			slog.Error("delete movement doc", "op", "logMovement", "collection", s.cfg.Collections.Movement, "doc", old.ID, "err", err)
+		}
+
+	}
+
+	year, month, day := t.Date()
+	date := time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+
+	doc := collection.Doc(today)
+
+	// The append runs in a transaction rather than with ArrayUnion:
+	// ArrayUnion skips entries equal to one already stored, and two events
+	// with the same timestamp should both be kept.
+	err = s.retryTransaction(ctx, func() error {
+
+		return s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+
+			snapshot, err := tx.Get(doc)
+
+			if status.Code(err) == codes.NotFound {
+				return tx.Set(doc, map[string]interface{}{
+					"date":      date,
+					"move_logs": []MoveLog{entry},
+				})
+			}
+
+			if err != nil {
+				return err
+			}
+
+			moves, _ := snapshot.DataAt("move_logs")
+			logs, _ := moves.([]interface{})
+
+			return tx.Update(doc, []firestore.Update{
+				{Path: "date", Value: date},
+				{Path: "move_logs", Value: append(logs, entry)},
+			})
+
+		})
+
+	})
+
+	if err != nil {
+		slog.Error("append movement", "op", "logMovement", "collection", s.cfg.Collections.Movement, "doc", doc.ID, "err", err)
+	}
+
+}
+
+// MovementDay is one day document as returned by GET /movement.
+type MovementDay struct {
+	ID       string    `json:"id" firestore:"-"`
+	Date     time.Time `json:"date" firestore:"date"`
+	MoveLogs []MoveLog `json:"moves" firestore:"move_logs"`
+}
+
+// pageSize parses the days query parameter, defaulting to def and allowing
+// at most max.
+func pageSize(value string, def, max int) (int, error) {
+
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+
+	if err != nil || n < 1 || n > max {
+		return 0, fmt.Errorf("days must be between 1 and %d", max)
+	}
+
+	return n, nil
+
+}
+
+// getMovement returns a site's movement day documents newest first, days per
+// page. The nextCursor of a full page is passed back as ?cursor= to get the
+// following page; it is empty on the last one.
+func (s *Server) getMovement(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	site, ok := siteParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	days, err := pageSize(r.URL.Query().Get("days"), s.cfg.MovementRetention, s.cfg.MovementPageMax)
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+
+	if cursor != "" && !validMovementDocID(cursor) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Invalid cursor"))
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	collection := s.collection(site, s.cfg.Collections.Movement)
+	query := collection.OrderBy("date", firestore.Desc).Limit(days)
+
+	if cursor != "" {
+
+		last, err := collection.Doc(cursor).Get(ctx)
+
+		if status.Code(err) == codes.NotFound {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid cursor"))
+			return
+		}
+
+		if err != nil {
+			slog.Error("read movement cursor", "op", "getMovement", "collection", s.cfg.Collections.Movement, "doc", cursor, "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		query = query.StartAfter(last)
+
+	}
+
+	docs, err := query.Documents(ctx).GetAll()
+
+	if err != nil {
+		slog.Error("list movement docs", "op", "getMovement", "collection", s.cfg.Collections.Movement, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	page := []MovementDay{}
+
+	for _, doc := range docs {
+
+		day := MovementDay{ID: doc.Ref.ID}
+
+		if err := doc.DataTo(&day); err != nil {
+			slog.Warn("skip malformed movement doc", "op", "getMovement", "doc", doc.Ref.ID, "err", err)
+			continue
+		}
+
+		page = append(page, day)
+
+	}
+
+	nextCursor := ""
+
+	if len(docs) == days {
+		nextCursor = docs[len(docs)-1].Ref.ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"site":       site,
+		"days":       page,
+		"nextCursor": nextCursor,
+	})
+
+}
+
+// MovementCount is the number of movement events on one day.
+type MovementCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// movementCounts lays out counts, keyed by movementDocID, over the days
+// retained up to now, oldest first. A day without a document counts zero.
+func movementCounts(now time.Time, days int, counts map[string]int) (series []MovementCount, total int) {
+
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+
+	for i := days - 1; i >= 0; i-- {
+
+		date := today.AddDate(0, 0, -i)
+		n := counts[movementDocID(date)]
+
+		series = append(series, MovementCount{Date: date.Format(rollupDateLayout), Count: n})
+		total += n
+
+	}
+
+	return
+
+}
+
+// getMovementSummary returns the site's movement event count per retained
+// day plus their total, for a bar chart.
+func (s *Server) getMovementSummary(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	site, ok := siteParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	docs, err := s.collection(site, s.cfg.Collections.Movement).
+		OrderBy("date", firestore.Desc).
+		Limit(s.cfg.MovementRetention).
+		Documents(ctx).
+		GetAll()
+
+	if err != nil {
+		slog.Error("list movement docs", "op", "getMovementSummary", "collection", s.cfg.Collections.Movement, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	counts := map[string]int{}
+
+	for _, doc := range docs {
+
+		moves, _ := doc.DataAt("move_logs")
+		logs, _ := moves.([]interface{})
+		counts[doc.Ref.ID] = len(logs)
+
+	}
+
+	series, total := movementCounts(time.Now().In(s.cfg.Location), s.cfg.MovementRetention, counts)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"site":  site,
+		"days":  series,
+		"total": total,
+	})
+
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestLogMovementDeletesOldestDay(t *testing.T) {
+
+	s := newTestServer(t)
+	ctx := context.Background()
+	collection := s.collection("test-site", s.cfg.Collections.Movement)
+	clearCollection(t, collection)
+
+	// Inserted out of order; "2023-4-10" sorts before "2023-4-4" as a string.
+	days := []int{10, 4, 8, 5, 9, 6, 7}
+
+	for _, day := range days {
+
+		date := time.Date(2023, 4, day, 0, 0, 0, 0, s.cfg.Location)
+		_, err := collection.Doc(date.Format("2006-1-2")).Set(ctx, map[string]interface{}{
+			"date":      date,
+			"move_logs": []MoveLog{},
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+	}
+
+	s.logMovement(ctx, "test-site", time.Date(2023, 4, 11, 12, 0, 0, 0, s.cfg.Location))
+
+	docs, err := collection.Documents(ctx).GetAll()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := map[string]bool{}
+
+	for _, doc := range docs {
+		ids[doc.Ref.ID] = true
+	}
+
+	if ids["2023-4-4"] {
+		t.Errorf("oldest day 2023-4-4 was not deleted: %v", ids)
+	}
+
+	for _, id := range []string{"2023-4-5", "2023-4-10", "2023-4-11"} {
+
+		if !ids[id] {
+			t.Errorf("%s missing: %v", id, ids)
+		}
+
+	}
+
+}
+
+func TestLogMovementKeepsRetentionDays(t *testing.T) {
+
+	s := newTestServer(t)
+	ctx := context.Background()
+	collection := s.collection("test-site", s.cfg.Collections.Movement)
+	clearCollection(t, collection)
+
+	seed := func(days ...int) {
+
+		for _, day := range days {
+
+			date := time.Date(2023, 5, day, 0, 0, 0, 0, s.cfg.Location)
+			_, err := collection.Doc(movementDocID(date)).Set(ctx, map[string]interface{}{
+				"date":      date,
+				"move_logs": []MoveLog{},
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+		}
+
+	}
+
+	count := func() int {
+
+		docs, err := collection.Documents(ctx).GetAll()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return len(docs)
+
+	}
+
+	seed(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	s.logMovement(ctx, "test-site", time.Date(2023, 5, 11, 12, 0, 0, 0, s.cfg.Location))
+
+	if n := count(); n != s.cfg.MovementRetention {
+		t.Errorf("after a new day: %d docs, want %d", n, s.cfg.MovementRetention)
+	}
+
+	// A second movement on the same day must not drop another day.
+	s.logMovement(ctx, "test-site", time.Date(2023, 5, 11, 13, 0, 0, 0, s.cfg.Location))
+
+	if n := count(); n != s.cfg.MovementRetention {
+		t.Errorf("after the same day: %d docs, want %d", n, s.cfg.MovementRetention)
+	}
+
+	if _, err := collection.Doc("2023-5-4").Get(ctx); err == nil {
+		t.Error("2023-5-4 should have been deleted")
+	}
+
+	if _, err := collection.Doc("2023-5-5").Get(ctx); err != nil {
+		t.Errorf("2023-5-5 should be kept: %v", err)
+	}
+
+}
+
+func TestDebounceMovement(t *testing.T) {
+
+	s := &Server{
+		cfg:          Config{Location: time.UTC, MovementDebounce: 10 * time.Second},
+		lastMovement: map[string]time.Time{},
+	}
+
+	start := time.Date(2023, 4, 10, 23, 59, 45, 0, time.UTC)
+
+	steps := []struct {
+		site string
+		at   time.Time
+		want bool
+	}{
+		{"a", start, false},
+		{"a", start.Add(3 * time.Second), true},
+		{"b", start.Add(3 * time.Second), false},
+		{"a", start.Add(11 * time.Second), false},
+		// Past midnight the previous day's movement no longer counts.
+		{"a", start.Add(16 * time.Second), false},
+		{"a", start.Add(20 * time.Second), true},
+	}
+
+	for i, step := range steps {
+
+		if got := s.debounceMovement(step.site, step.at); got != step.want {
+			t.Errorf("step %d: debounceMovement(%s, %s) = %v, want %v", i, step.site, step.at.Format(time.TimeOnly), got, step.want)
+		}
+
+	}
+
+}
+
+func TestPageSize(t *testing.T) {
+
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", 7, false},
+		{"1", 1, false},
+		{"31", 31, false},
+		{"0", 0, true},
+		{"32", 0, true},
+		{"-3", 0, true},
+		{"week", 0, true},
+	}
+
+	for _, tt := range tests {
+
+		got, err := pageSize(tt.value, 7, 31)
+
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("pageSize(%q) = %d, %v; want %d, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+
+	}
+
+}
+
+func TestValidMovementDocID(t *testing.T) {
+
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{movementDocID(time.Date(2023, 4, 10, 12, 0, 0, 0, defaultTimeZone)), true},
+		{"2023-12-31", true},
+		{"2023-04-10", false},
+		{"2023-2-30", false},
+		{"2023-4", false},
+		{"room-1", false},
+		{"2023-4-10/extra", false},
+	}
+
+	for _, tt := range tests {
+
+		if got := validMovementDocID(tt.id); got != tt.want {
+			t.Errorf("validMovementDocID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+
+	}
+
+}
+
+func TestGetMovementInvalidCursor(t *testing.T) {
+
+	s := &Server{cfg: Config{MovementRetention: 7, MovementPageMax: 31}}
+
+	for _, cursor := range []string{"room-1", "2023-04-10"} {
+
+		w := httptest.NewRecorder()
+		s.getMovement(w, httptest.NewRequest("GET", "/movement?site=room-1&cursor="+cursor, nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("cursor %q: status = %d, want %d", cursor, w.Code, http.StatusBadRequest)
+		}
+
+	}
+
+}
+
+func TestLogMovementConcurrent(t *testing.T) {
+
+	s := newTestServer(t)
+	ctx := context.Background()
+	collection := s.collection("test-site", s.cfg.Collections.Movement)
+	clearCollection(t, collection)
+
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, s.cfg.Location)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+
+		wg.Add(1)
+
+		go func(i int) {
+
+			defer wg.Done()
+			s.logMovement(ctx, "test-site", now.Add(time.Duration(i)*time.Second))
+
+		}(i)
+
+	}
+
+	wg.Wait()
+
+	snapshot, err := collection.Doc(movementDocID(now)).Get(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moves, _ := snapshot.DataAt("move_logs")
+
+	if logs, _ := moves.([]interface{}); len(logs) != 10 {
+		t.Errorf("move_logs = %d entries, want 10", len(logs))
+	}
+
+}
+
+func TestMovementCounts(t *testing.T) {
+
+	now := time.Date(2023, 5, 4, 15, 0, 0, 0, time.UTC)
+	counts := map[string]int{"2023-5-4": 3, "2023-5-2": 1, "2023-4-20": 9}
+
+	series, total := movementCounts(now, 3, counts)
+
+	want := []MovementCount{{"2023-05-02", 1}, {"2023-05-03", 0}, {"2023-05-04", 3}}
+
+	if len(series) != len(want) {
+		t.Fatalf("series = %v, want %v", series, want)
+	}
+
+	for i := range want {
+
+		if series[i] != want[i] {
+			t.Errorf("day %d = %v, want %v", i, series[i], want[i])
+		}
+
+	}
+
+	if total != 4 {
+		t.Errorf("total = %d, want 4", total)
+	}
+
+}
+
+func TestLogMovementNoGoroutineLeak(t *testing.T) {
+
+	s := newTestServer(t)
+	ctx := context.Background()
+	collection := s.collection("leak-site", s.cfg.Collections.Movement)
+	clearCollection(t, collection)
+	t.Cleanup(func() { clearCollection(t, collection) })
+
+	// The first call opens the client's connection, whose goroutines live
+	// as long as the client.
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, s.cfg.Location)
+	s.logMovement(ctx, "leak-site", now)
+
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	for i := 1; i <= 20; i++ {
+		s.logMovement(ctx, "leak-site", now.Add(time.Duration(i)*time.Minute))
+	}
+
+}
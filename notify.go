@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/messaging"
+	"google.golang.org/api/iterator"
+)
+
+// SendResult summarizes how many devices a notification reached. DryRun
+// marks a notification that was only logged.
+type SendResult struct {
+	Sent   int  `json:"sent"`
+	Failed int  `json:"failed"`
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// Notifier is the part of the FCM client the server uses, so tests can stand
+// in a fake for *messaging.Client.
+type Notifier interface {
+	Send(ctx context.Context, message *messaging.Message) (string, error)
+	SendMulticast(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error)
+}
+
+var _ Notifier = (*messaging.Client)(nil)
+
+// The data payload sent to the app always carries these keys:
+//
+//	Title     notification title, prefixed with the site
+//	Body      notification body, lines separated by "<br>"
+//	Site      site ID the alert refers to
+//	Severity  "info", "warning" or "critical"
+//	type      one of the type* values below
+//
+// and, when set, the Android channel and sound as "channel" and "sound" and
+// the configured icon and image URLs as "icon" and "image", so the app can
+// style the notification itself.
+//
+// The type key replaces the older empty "Temp", "Move" and "Summary" flag
+// keys, which are no longer sent.
+const (
+	typeAmbient  = "ambient"
+	typeMovement = "movement"
+	typeSummary  = "summary"
+	typeOffline  = "offline"
+	typeRising   = "rising"
+)
+
+// multicastLimit is the maximum number of tokens FCM accepts in a single
+// SendMulticast call.
+const multicastLimit = 500
+
+// broadcast delivers the data message either to the configured topic or to
+// every device token registered for the site. alert only labels the log
+// entries; the Android and APNs options follow data["Severity"] and the
+// style of data["type"].
+func (s *Server) broadcast(ctx context.Context, site, alert string, data map[string]string) (result SendResult, err error) {
+
+	result.DryRun = s.cfg.DryRun
+
+	if s.fcm == nil && !s.cfg.DryRun {
+		return result, errMessagingUnavailable
+	}
+
+	if !s.cfg.DryRun && !s.breaker.allow(time.Now()) {
+		slog.Warn("fcm circuit open, notification skipped", "site", site, "alert", alert)
+		return result, errCircuitOpen
+	}
+
+	style := s.cfg.AndroidStyles[data["type"]]
+	android := androidConfig(data["Severity"], style)
+	apns := apnsConfig(data, style, s.cfg.APNSBundleID)
+
+	styled := make(map[string]string, len(data)+4)
+
+	for key, value := range data {
+		styled[key] = value
+	}
+
+	if notification := android.Notification; notification != nil {
+
+		if notification.ChannelID != "" {
+			styled["channel"] = notification.ChannelID
+		}
+
+		if notification.Sound != "" {
+			styled["sound"] = notification.Sound
+		}
+
+	}
+
+	if s.cfg.NotificationIconURL != "" {
+		styled["icon"] = s.cfg.NotificationIconURL
+	}
+
+	if s.cfg.NotificationImageURL != "" {
+		styled["image"] = s.cfg.NotificationImageURL
+	}
+
+	data = styled
+	notification := s.notificationBlock(data, android, apns)
+
+	if s.cfg.UseTopic && s.cfg.DryRun {
+		slog.Info("dry run, notification not sent", "site", site, "alert", alert, "topic", s.cfg.TopicName, "priority", android.Priority, "data", data)
+		return result, nil
+	}
+
+	if s.cfg.UseTopic {
+
+		_, err = s.fcm.Send(ctx, &messaging.Message{
+			Data:         data,
+			Notification: notification,
+			Topic:        s.cfg.TopicName,
+			Android:      android,
+			APNS:         apns,
+		})
+		s.breaker.record(err, time.Now())
+
+		if err != nil {
+			notificationsFailed.Inc()
+			return
+		}
+
+		notificationsSent.Inc()
+		result.Sent = 1
+		return result, nil
+
+	}
+
+	var deviceTokens []string
+	var tokenRefs []*firestore.DocumentRef
+
+	err = s.retry(ctx, func() (err error) {
+		deviceTokens, tokenRefs, err = s.deviceTokens(ctx, site)
+		return
+	})
+
+	if err != nil {
+
+		cached, cachedRefs, age, ok := s.tokenCache.load(site, time.Now())
+
+		if !ok {
+			return
+		}
+
+		slog.Warn("token read failed, using cached tokens", "site", site, "alert", alert, "tokens", len(cached), "age", age, "err", err)
+		deviceTokens, tokenRefs, err = cached, cachedRefs, nil
+
+	} else {
+		s.tokenCache.store(site, deviceTokens, tokenRefs, time.Now())
+	}
+
+	if len(deviceTokens) == 0 {
+		slog.Info("no device tokens, skipping multicast", "site", site, "alert", alert)
+		return result, nil
+	}
+
+	if s.cfg.DryRun {
+		slog.Info("dry run, multicast not sent", "site", site, "alert", alert, "tokens", len(deviceTokens), "priority", android.Priority, "data", data)
+		return result, nil
+	}
+
+	pruned := 0
+	var sendErr error
+
+	outcomes := s.sendMulticasts(ctx, messaging.MulticastMessage{
+		Data:         data,
+		Notification: notification,
+		Tokens:       deviceTokens,
+		Android:      android,
+		APNS:         apns,
+	}, tokenRefs)
+
+	for _, outcome := range outcomes {
+
+		result.Sent += outcome.sent
+		result.Failed += outcome.failed
+		pruned += outcome.pruned
+
+		if outcome.err != nil {
+			sendErr = outcome.err
+		}
+
+	}
+
+	notificationsSent.Add(float64(result.Sent))
+	notificationsFailed.Add(float64(result.Failed))
+
+	slog.Info("multicast sent", "site", site, "alert", alert, "tokens", len(deviceTokens), "sent", result.Sent, "failed", result.Failed, "pruned", pruned)
+
+	if result.Sent == 0 && sendErr != nil {
+		return result, sendErr
+	}
+
+	return result, nil
+
+}
+
+// notificationBlock returns the FCM notification block sent alongside the
+// data when NOTIFICATION_BLOCK is set, and nil otherwise.
+//
+// Messages are data-only by default: the app builds the notification from
+// the data keys, so it controls the formatting and the "<br>" line breaks.
+// A notification block lets the OS show the alert while the app is killed
+// and shows the image natively, but it is then displayed by the OS instead
+// of the app's handler. It also sets the Android icon and the iOS image on
+// android and apns.
+func (s *Server) notificationBlock(data map[string]string, android *messaging.AndroidConfig, apns *messaging.APNSConfig) *messaging.Notification {
+
+	if !s.cfg.NotificationBlock {
+		return nil
+	}
+
+	if s.cfg.NotificationIconURL != "" {
+
+		if android.Notification == nil {
+			android.Notification = &messaging.AndroidNotification{}
+		}
+
+		android.Notification.Icon = s.cfg.NotificationIconURL
+
+	}
+
+	if s.cfg.NotificationImageURL != "" {
+		apns.FCMOptions = &messaging.APNSFCMOptions{ImageURL: s.cfg.NotificationImageURL}
+		apns.Payload.Aps.MutableContent = true
+	}
+
+	return &messaging.Notification{
+		Title:    data["Title"],
+		Body:     strings.ReplaceAll(data["Body"], "<br>", "\n"),
+		ImageURL: s.cfg.NotificationImageURL,
+	}
+
+}
+
+// deviceTokens reads the registered tokens for the site along with their
+// documents, in matching order. Documents without a string token field are
+// logged and skipped.
+func (s *Server) deviceTokens(ctx context.Context, site string) (tokens []string, refs []*firestore.DocumentRef, err error) {
+
+	docs := s.tokenCollection(site).Documents(ctx)
+	defer docs.Stop()
+
+	for {
+
+		doc, err := docs.Next()
+
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		token, ok := tokenFromDoc(doc.Data())
+
+		if !ok {
+			slog.Warn("skip malformed token doc", "op", "deviceTokens", "doc", doc.Ref.ID)
+			continue
+		}
+
+		tokens = append(tokens, token)
+		refs = append(refs, doc.Ref)
+
+	}
+
+	return
+
+}
+
+func tokenFromDoc(data map[string]interface{}) (string, bool) {
+
+	token, ok := data["token"].(string)
+	return token, ok && token != ""
+
+}
+
+// pruneTokens deletes the token documents whose multicast result reports the
+// registration token as no longer registered. refs must be in the same order
+// as the tokens of the multicast that produced resp.
+func (s *Server) pruneTokens(ctx context.Context, refs []*firestore.DocumentRef, resp *messaging.BatchResponse) (pruned int, err error) {
+
+	batch := s.fs.Batch()
+
+	for i, result := range resp.Responses {
+
+		if result.Success || i >= len(refs) {
+			continue
+		}
+
+		if messaging.IsRegistrationTokenNotRegistered(result.Error) {
+			batch.Delete(refs[i])
+			pruned++
+		}
+
+	}
+
+	if pruned == 0 {
+		return
+	}
+
+	if _, err = batch.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return
+
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"firebase.google.com/go/messaging"
+)
+
+// fakeNotifier records the messages it is asked to send and reports every
+// token as delivered, or fails every Send with err when it is set.
+type fakeNotifier struct {
+	mu         sync.Mutex
+	sent       []*messaging.Message
+	multicasts []*messaging.MulticastMessage
+	err        error
+}
+
+func (f *fakeNotifier) Send(ctx context.Context, message *messaging.Message) (string, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sent = append(f.sent, message)
+
+	if f.err != nil {
+		return "", f.err
+	}
+
+	return "fake-id", nil
+
+}
+
+func (f *fakeNotifier) SendMulticast(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.multicasts = append(f.multicasts, message)
+
+	resp := &messaging.BatchResponse{SuccessCount: len(message.Tokens)}
+
+	for range message.Tokens {
+		resp.Responses = append(resp.Responses, &messaging.SendResponse{Success: true, MessageID: "fake-id"})
+	}
+
+	return resp, nil
+
+}
+
+func TestTokenFromDoc(t *testing.T) {
+
+	tests := []struct {
+		data   map[string]interface{}
+		want   string
+		wantOK bool
+	}{
+		{map[string]interface{}{"token": "abc"}, "abc", true},
+		{map[string]interface{}{"token": ""}, "", false},
+		{map[string]interface{}{"token": int64(42)}, "", false},
+		{map[string]interface{}{"token": nil}, "", false},
+		{map[string]interface{}{}, "", false},
+	}
+
+	for _, tt := range tests {
+
+		if got, ok := tokenFromDoc(tt.data); got != tt.want || ok != tt.wantOK {
+			t.Errorf("tokenFromDoc(%v) = %q, %v; want %q, %v", tt.data, got, ok, tt.want, tt.wantOK)
+		}
+
+	}
+
+}
+
+func TestDeviceTokensSkipsMalformed(t *testing.T) {
+
+	s := newTestServer(t)
+	ctx := context.Background()
+	collection := s.tokenCollection("test-site")
+	clearCollection(t, collection)
+
+	docs := map[string]map[string]interface{}{
+		"good-1":    {"token": "good-1"},
+		"no-field":  {"other": "x"},
+		"not-str":   {"token": int64(7)},
+		"good-2":    {"token": "good-2"},
+		"empty-str": {"token": ""},
+	}
+
+	for id, data := range docs {
+
+		if _, err := collection.Doc(id).Set(ctx, data); err != nil {
+			t.Fatal(err)
+		}
+
+	}
+
+	tokens, refs, err := s.deviceTokens(ctx, "test-site")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tokens) != 2 || len(refs) != 2 {
+		t.Fatalf("deviceTokens() = %v, want good-1 and good-2", tokens)
+	}
+
+	for i, token := range tokens {
+
+		if refs[i].ID != token {
+			t.Errorf("token %q paired with doc %q", token, refs[i].ID)
+		}
+
+	}
+
+}
+
+func TestBroadcastTopic(t *testing.T) {
+
+	fcm := &fakeNotifier{}
+	s := &Server{cfg: Config{UseTopic: true, TopicName: "alerts"}, fcm: fcm}
+
+	data := map[string]string{"Title": "t", "Body": "b"}
+	result, err := s.broadcast(context.Background(), "room-1", alertTemperature, data)
+
+	if err != nil {
+		t.Fatalf("broadcast() error = %v", err)
+	}
+
+	if result.Sent != 1 || len(fcm.sent) != 1 {
+		t.Fatalf("sent = %d with %d messages, want 1 and 1", result.Sent, len(fcm.sent))
+	}
+
+	if msg := fcm.sent[0]; msg.Topic != "alerts" || msg.Data["Title"] != "t" || msg.Android == nil || msg.Android.Priority != "high" {
+		t.Errorf("message = %+v, want topic alerts with the data and high priority", msg)
+	}
+
+}
+
+func TestBroadcastImage(t *testing.T) {
+
+	fcm := &fakeNotifier{}
+	s := &Server{cfg: Config{
+		UseTopic:             true,
+		TopicName:            "alerts",
+		NotificationIconURL:  "ic_monitor",
+		NotificationImageURL: "https://example.com/brand.png",
+	}, fcm: fcm}
+
+	data := map[string]string{"Title": "t", "Body": "a<br>b", "Severity": severityWarning}
+
+	if _, err := s.broadcast(context.Background(), "room-1", alertTemperature, data); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := fcm.sent[0]
+
+	if msg.Notification != nil || msg.Data["icon"] != "ic_monitor" || msg.Data["image"] != "https://example.com/brand.png" {
+		t.Errorf("data-only message = %+v / %v, want no notification block and the icon and image as data", msg.Notification, msg.Data)
+	}
+
+	s.cfg.NotificationBlock = true
+
+	if _, err := s.broadcast(context.Background(), "room-1", alertTemperature, data); err != nil {
+		t.Fatal(err)
+	}
+
+	msg = fcm.sent[1]
+
+	if msg.Notification == nil || msg.Notification.ImageURL != "https://example.com/brand.png" || msg.Notification.Body != "a\nb" {
+		t.Fatalf("notification = %+v, want the image and the body with line breaks", msg.Notification)
+	}
+
+	if msg.Android.Notification.Icon != "ic_monitor" || msg.APNS.FCMOptions == nil || !msg.APNS.Payload.Aps.MutableContent {
+		t.Errorf("android = %+v, apns = %+v; want the icon and the iOS image", msg.Android.Notification, msg.APNS)
+	}
+
+}
+
+func TestBroadcastWithoutTokens(t *testing.T) {
+
+	s := newTestServer(t)
+	fcm := &fakeNotifier{}
+	s.fcm = fcm
+
+	tokens := s.tokenCollection("empty-site")
+	clearCollection(t, tokens)
+
+	result, err := s.broadcast(context.Background(), "empty-site", alertMovement, map[string]string{"Title": "t"})
+
+	if err != nil || result != (SendResult{}) {
+		t.Fatalf("broadcast() = %+v, %v; want no sends and no error", result, err)
+	}
+
+	if len(fcm.multicasts) != 0 {
+		t.Errorf("%d multicasts sent without tokens", len(fcm.multicasts))
+	}
+
+}
+
+func TestBroadcastWithoutMessaging(t *testing.T) {
+
+	s := &Server{cfg: Config{UseTopic: true, TopicName: "alerts"}}
+
+	_, err := s.broadcast(context.Background(), "room-1", alertTemperature, map[string]string{"Title": "t"})
+
+	if !errors.Is(err, errMessagingUnavailable) {
+		t.Errorf("broadcast() error = %v, want errMessagingUnavailable", err)
+	}
+
+}
+
+func TestBroadcastAndroidStyle(t *testing.T) {
+
+	fcm := &fakeNotifier{}
+	s := &Server{cfg: Config{
+		UseTopic:      true,
+		TopicName:     "alerts",
+		AndroidStyles: map[string]androidStyle{typeMovement: {Channel: "movement", Sound: "chime"}},
+	}, fcm: fcm}
+
+	data := map[string]string{"Title": "t", "Severity": severityWarning, "type": typeMovement}
+
+	if _, err := s.broadcast(context.Background(), "room-1", alertMovement, data); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := fcm.sent[0]
+
+	if msg.Android.Notification.Sound != "chime" || msg.Data["channel"] != "movement" || msg.Data["sound"] != "chime" {
+		t.Errorf("message = %+v / %+v, want the movement channel and chime in both", msg.Android.Notification, msg.Data)
+	}
+
+	if _, ok := data["sound"]; ok {
+		t.Error("caller's data map was modified")
+	}
+
+}
+
+func TestBroadcastDryRun(t *testing.T) {
+
+	fcm := &fakeNotifier{}
+	s := &Server{cfg: Config{UseTopic: true, TopicName: "alerts", DryRun: true}, fcm: fcm}
+
+	result, err := s.broadcast(context.Background(), "room-1", alertTemperature, map[string]string{"Title": "t"})
+
+	if err != nil || !result.DryRun {
+		t.Fatalf("broadcast() = %+v, %v; want a dry run", result, err)
+	}
+
+	if len(fcm.sent) != 0 {
+		t.Errorf("%d messages sent in dry run", len(fcm.sent))
+	}
+
+	// Dry runs work without a Messaging client too.
+	s.fcm = nil
+
+	if _, err := s.broadcast(context.Background(), "room-1", alertTemperature, map[string]string{"Title": "t"}); err != nil {
+		t.Errorf("broadcast() without messaging error = %v", err)
+	}
+
+}
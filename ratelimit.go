@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket holding up to burst tokens, refilled at rate
+// tokens per second.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps one token bucket per client IP in memory.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: map[string]*bucket{}}
+
+}
+
+// allow takes a token from the key's bucket. When the bucket is empty it
+// returns false and how long until the next token.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens--
+	return true, 0
+
+}
+
+// evict drops the buckets that have refilled completely, which behave the
+// same as a new one.
+func (l *rateLimiter) evict(now time.Time) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.buckets {
+
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+
+	}
+
+}
+
+// evictIdle runs evict every interval until ctx is done.
+func (l *rateLimiter) evictIdle(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.evict(now)
+		}
+
+	}
+
+}
+
+// clientIP returns the IP a request came from: the last X-Forwarded-For
+// entry when trustProxy is set, else the RemoteAddr host. The last entry is
+// the one the proxy appended; anything before it came from the client and
+// can be forged.
+func clientIP(r *http.Request, trustProxy bool) string {
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); trustProxy && len(forwarded) > 0 {
+
+		entries := strings.Split(forwarded[len(forwarded)-1], ",")
+
+		if last := strings.TrimSpace(entries[len(entries)-1]); last != "" {
+			return last
+		}
+
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+
+}
+
+// rateLimit answers 429 with a Retry-After header once a client IP runs out
+// of tokens. It is a no-op when rate limiting is disabled.
+func (s *Server) rateLimit(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if s.limiter == nil {
+			next(w, r)
+			return
+		}
+
+		ok, wait := s.limiter.allow(clientIP(r, s.cfg.TrustProxy), time.Now())
+
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte("Too Many Requests"))
+			return
+		}
+
+		next(w, r)
+
+	}
+
+}
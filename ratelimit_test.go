@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+
+	l := newRateLimiter(1, 2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+
+		if ok, _ := l.allow("10.0.0.1", now); !ok {
+			t.Fatalf("request %d within burst was limited", i)
+		}
+
+	}
+
+	ok, wait := l.allow("10.0.0.1", now)
+
+	if ok || wait != time.Second {
+		t.Errorf("allow() past burst = %v, %v; want false, 1s", ok, wait)
+	}
+
+	if ok, _ := l.allow("10.0.0.2", now); !ok {
+		t.Error("another IP was limited")
+	}
+
+	if ok, _ := l.allow("10.0.0.1", now.Add(time.Second)); !ok {
+		t.Error("request after refill was limited")
+	}
+
+}
+
+func TestRateLimiterEvict(t *testing.T) {
+
+	l := newRateLimiter(1, 2)
+	now := time.Now()
+
+	l.allow("idle", now)
+	l.allow("busy", now.Add(5*time.Second))
+	l.allow("busy", now.Add(5*time.Second))
+
+	l.evict(now.Add(5 * time.Second))
+
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("idle bucket kept")
+	}
+
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("busy bucket evicted")
+	}
+
+}
+
+func TestClientIP(t *testing.T) {
+
+	r := httptest.NewRequest("POST", "/sendAll", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+	if got := clientIP(r, false); got != "192.0.2.1" {
+		t.Errorf("clientIP() without proxy = %q, want 192.0.2.1", got)
+	}
+
+	if got := clientIP(r, true); got != "203.0.113.7" {
+		t.Errorf("clientIP() behind proxy = %q, want 203.0.113.7", got)
+	}
+
+}
+
+func TestClientIPSpoofed(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		forwarded []string
+		want      string
+	}{
+		// The client sent its own header and the proxy appended the real IP.
+		{"forged entry", []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+		{"forged header line", []string{"198.51.100.1", "203.0.113.7"}, "203.0.113.7"},
+		{"trailing comma", []string{"198.51.100.1,"}, "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+
+		r := httptest.NewRequest("POST", "/sendAll", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+
+		for _, value := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+
+		if got := clientIP(r, true); got != tt.want {
+			t.Errorf("%s: clientIP() = %q, want %q", tt.name, got, tt.want)
+		}
+
+	}
+
+}
+
+func TestRateLimit(t *testing.T) {
+
+	s := &Server{limiter: newRateLimiter(0.5, 1)}
+	handler := s.rateLimit(func(w http.ResponseWriter, r *http.Request) {})
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", "/sendAll", nil))
+
+		if w.Code != want {
+			t.Fatalf("request %d: status = %d, want %d", i, w.Code, want)
+		}
+
+		if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "2" {
+			t.Errorf("Retry-After = %q, want 2", w.Header().Get("Retry-After"))
+		}
+
+	}
+
+}
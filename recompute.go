@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// recomputePageSize is how many ambient docs are read and updated per
+// batch; it must stay under Firestore's 500 writes per batch.
+const recomputePageSize = 200
+
+// recomputeDerived returns the heat index and dew point for a stored ambient
+// reading and whether they differ from the stored ones. ok is false when the
+// doc has no usable temperature or humidity.
+func recomputeDerived(data map[string]interface{}) (heatIndex, dewPoint float64, changed, ok bool) {
+
+	temperature, okTemp := slotValue(data, "temperature")
+	humidity, okHum := slotValue(data, "humidity")
+
+	if !okTemp || !okHum {
+		return 0, 0, false, false
+	}
+
+	heatIndex = computeHeatIndex(temperature, humidity)
+	dewPoint = computeDewPoint(temperature, humidity)
+
+	storedHeat, okHeat := slotValue(data, "heatIndex")
+	storedDew, okDew := slotValue(data, "dewPoint")
+
+	changed = !okHeat || !okDew || !sameValue(storedHeat, heatIndex) || !sameValue(storedDew, dewPoint)
+	return heatIndex, dewPoint, changed, true
+
+}
+
+func sameValue(a, b float64) bool {
+
+	return math.Abs(a-b) < 1e-9
+
+}
+
+// recompute backfills heatIndex and dewPoint on a site's stored ambient
+// readings, or the ?sensor= one's, from their temperature and humidity.
+// Docs that already hold the computed values are left alone, so running it
+// again updates nothing.
+func (s *Server) recompute(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	site, ok := siteParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	sensor, ok := sensorParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	scanned, updated, err := s.recomputeAmbient(r.Context(), site, sensor)
+
+	if err != nil {
+		slog.Error("recompute ambient", "op", "recompute", "collection", s.cfg.Collections.Ambient, "scanned", scanned, "updated", updated, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("recomputed ambient", "site", site, "sensor", sensor, "scanned", scanned, "updated", updated)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"site":    site,
+		"sensor":  sensor,
+		"scanned": scanned,
+		"updated": updated,
+	})
+
+}
+
+// recomputeAmbient walks the sensor's ambient collection in document ID
+// order, one page per Firestore batch, each page bounded by FirestoreTimeout.
+func (s *Server) recomputeAmbient(ctx context.Context, site, sensor string) (scanned, updated int, err error) {
+
+	collection := s.sensorCollection(site, sensor, s.cfg.Collections.Ambient)
+	var last *firestore.DocumentSnapshot
+
+	for {
+
+		var n int
+		var page []*firestore.DocumentSnapshot
+
+		if page, n, err = s.recomputePage(ctx, collection, last); err != nil {
+			return
+		}
+
+		scanned += len(page)
+		updated += n
+
+		if len(page) < recomputePageSize {
+			return
+		}
+
+		last = page[len(page)-1]
+
+	}
+
+}
+
+func (s *Server) recomputePage(ctx context.Context, collection *firestore.CollectionRef, last *firestore.DocumentSnapshot) (page []*firestore.DocumentSnapshot, updated int, err error) {
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.FirestoreTimeout)
+	defer cancel()
+
+	defer observeFirestore("recompute", time.Now())
+
+	query := collection.OrderBy(firestore.DocumentID, firestore.Asc).Limit(recomputePageSize)
+
+	if last != nil {
+		query = query.StartAfter(last)
+	}
+
+	err = s.retry(ctx, func() (err error) {
+		page, err = query.Documents(ctx).GetAll()
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	batch := s.fs.Batch()
+
+	for _, doc := range page {
+
+		heatIndex, dewPoint, changed, ok := recomputeDerived(doc.Data())
+
+		if !ok {
+			slog.Warn("skip ambient doc without readings", "op", "recompute", "doc", doc.Ref.ID)
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+
+		batch.Update(doc.Ref, []firestore.Update{
+			{Path: "heatIndex", Value: heatIndex},
+			{Path: "dewPoint", Value: dewPoint},
+		})
+		updated++
+
+	}
+
+	if updated == 0 {
+		return
+	}
+
+	err = s.retry(ctx, func() (err error) {
+		_, err = batch.Commit(ctx)
+		return
+	})
+
+	if err != nil {
+		return page, 0, err
+	}
+
+	return
+
+}
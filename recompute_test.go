@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecomputeInvalidSensor(t *testing.T) {
+
+	s := &Server{}
+	w := httptest.NewRecorder()
+	s.recompute(w, httptest.NewRequest("POST", "/recompute?site=room-1&sensor=rack/2", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+}
+
+func TestRecomputeDerived(t *testing.T) {
+
+	heat := computeHeatIndex(32, 70)
+	dew := computeDewPoint(32, 70)
+
+	tests := []struct {
+		name        string
+		data        map[string]interface{}
+		wantChanged bool
+		wantOK      bool
+	}{
+		{"firmware values", map[string]interface{}{"temperature": 32.0, "humidity": int64(70), "heatIndex": 35.0, "dewPoint": 0.0}, true, true},
+		{"missing derived", map[string]interface{}{"temperature": 32.0, "humidity": 70.0}, true, true},
+		{"already computed", map[string]interface{}{"temperature": int64(32), "humidity": 70.0, "heatIndex": heat, "dewPoint": dew}, false, true},
+		{"no humidity", map[string]interface{}{"temperature": 32.0}, false, false},
+		{"bad temperature", map[string]interface{}{"temperature": "hot", "humidity": 70.0}, false, false},
+	}
+
+	for _, tt := range tests {
+
+		gotHeat, gotDew, changed, ok := recomputeDerived(tt.data)
+
+		if changed != tt.wantChanged || ok != tt.wantOK {
+			t.Errorf("%s: changed, ok = %v, %v; want %v, %v", tt.name, changed, ok, tt.wantChanged, tt.wantOK)
+		}
+
+		if ok && (gotHeat != heat || gotDew != dew) {
+			t.Errorf("%s: got %v, %v; want %v, %v", tt.name, gotHeat, gotDew, heat, dew)
+		}
+
+	}
+
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// retryBaseDelay is the backoff before the second attempt; it doubles on
+// each further attempt.
+var retryBaseDelay = 100 * time.Millisecond
+
+// isRetryable reports whether a Firestore error is transient.
+func isRetryable(err error) bool {
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted, codes.DeadlineExceeded:
+		return true
+	}
+
+	return false
+
+}
+
+// isUnavailable reports whether Firestore could not be reached, the one
+// error worth retrying a whole transaction for.
+func isUnavailable(err error) bool {
+
+	return status.Code(err) == codes.Unavailable
+
+}
+
+// withRetry calls fn up to maxAttempts times, retrying only transient gRPC
+// errors with exponential backoff and jitter, and giving up early once ctx
+// is done. It returns the last error from fn.
+func withRetry(ctx context.Context, fn func() error, maxAttempts int) error {
+
+	return withRetryIf(ctx, fn, maxAttempts, isRetryable)
+
+}
+
+// withRetryIf is withRetry for the errors retryable accepts.
+func withRetryIf(ctx context.Context, fn func() error, maxAttempts int, retryable func(error) bool) (err error) {
+
+	for attempt := 1; ; attempt++ {
+
+		err = fn()
+
+		if err == nil || attempt >= maxAttempts || !retryable(err) {
+			return
+		}
+
+		delay := retryBaseDelay << (attempt - 1)
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+	}
+
+}
+
+// retry runs fn with the configured number of Firestore attempts.
+func (s *Server) retry(ctx context.Context, fn func() error) error {
+
+	return withRetry(ctx, fn, s.cfg.FirestoreAttempts)
+
+}
+
+// retryTransaction runs a RunTransaction call with the configured number of
+// attempts, retrying it only while Firestore is unavailable. RunTransaction
+// already retries aborted commits itself; retrying those again would
+// multiply its attempts.
+func (s *Server) retryTransaction(ctx context.Context, fn func() error) error {
+
+	return withRetryIf(ctx, fn, s.cfg.FirestoreAttempts, isUnavailable)
+
+}
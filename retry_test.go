@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failingStub fails with err for the first failures calls and then succeeds.
+type failingStub struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *failingStub) call() error {
+
+	f.calls++
+
+	if f.calls <= f.failures {
+		return f.err
+	}
+
+	return nil
+
+}
+
+func TestWithRetry(t *testing.T) {
+
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+
+	tests := []struct {
+		name      string
+		stub      failingStub
+		attempts  int
+		wantErr   bool
+		wantCalls int
+	}{
+		{"succeeds first time", failingStub{failures: 0, err: unavailable}, 3, false, 1},
+		{"recovers after retries", failingStub{failures: 2, err: unavailable}, 3, false, 3},
+		{"aborted is retried", failingStub{failures: 1, err: status.Error(codes.Aborted, "aborted")}, 3, false, 2},
+		{"deadline is retried", failingStub{failures: 1, err: status.Error(codes.DeadlineExceeded, "deadline")}, 3, false, 2},
+		{"gives up after max attempts", failingStub{failures: 5, err: unavailable}, 3, true, 3},
+		{"not found is not retried", failingStub{failures: 5, err: status.Error(codes.NotFound, "missing")}, 3, true, 1},
+		{"plain error is not retried", failingStub{failures: 5, err: errors.New("boom")}, 3, true, 1},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			stub := tt.stub
+			err := withRetry(context.Background(), stub.call, tt.attempts)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("withRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if stub.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", stub.calls, tt.wantCalls)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRetryTransaction(t *testing.T) {
+
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	s := &Server{cfg: Config{FirestoreAttempts: 3}}
+
+	tests := []struct {
+		name      string
+		stub      failingStub
+		wantCalls int
+	}{
+		{"unavailable is retried", failingStub{failures: 1, err: status.Error(codes.Unavailable, "unavailable")}, 2},
+		// RunTransaction has already retried these itself.
+		{"aborted is not retried", failingStub{failures: 5, err: status.Error(codes.Aborted, "aborted")}, 1},
+		{"deadline is not retried", failingStub{failures: 5, err: status.Error(codes.DeadlineExceeded, "deadline")}, 1},
+	}
+
+	for _, tt := range tests {
+
+		stub := tt.stub
+		s.retryTransaction(context.Background(), stub.call)
+
+		if stub.calls != tt.wantCalls {
+			t.Errorf("%s: calls = %d, want %d", tt.name, stub.calls, tt.wantCalls)
+		}
+
+	}
+
+}
+
+func TestWithRetryStopsOnCancel(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	stub := failingStub{failures: 5, err: status.Error(codes.Unavailable, "unavailable")}
+
+	if err := withRetry(ctx, stub.call, 5); err == nil || stub.calls != 1 {
+		t.Errorf("withRetry() = %v after %d calls, want error after 1 call", err, stub.calls)
+	}
+
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// rollupDateLayout is the ID of the temperature_daily docs.
+const rollupDateLayout = "2006-01-02"
+
+// daySlots returns the hourly slots whose hour falls on day, in day's
+// location. Slots from other days or without an hour are dropped.
+func daySlots(slots []interface{}, day time.Time) (filled []interface{}) {
+
+	year, month, date := day.Date()
+	start := time.Date(year, month, date, 0, 0, 0, 0, day.Location())
+	end := start.AddDate(0, 0, 1)
+
+	for _, slot := range slots {
+
+		m, ok := slot.(map[string]interface{})
+
+		if !ok {
+			continue
+		}
+
+		if at, ok := m["hour"].(time.Time); ok && !at.Before(start) && at.Before(end) {
+			filled = append(filled, slot)
+		}
+
+	}
+
+	return
+
+}
+
+// rollup stores the min, max, mean and sample count of a day's adjusted
+// temperatures in temperature_daily/{YYYY-MM-DD}, the ?sensor= one's for a
+// named sensor. The day defaults to yesterday and can be picked with
+// ?date=YYYY-MM-DD; a day without readings is not stored. It reads the
+// rolling 24-hour array, so it is meant to be scheduled shortly after
+// midnight, before the new day's readings replace the old slots.
+func (s *Server) rollup(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	site, ok := siteParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	sensor, ok := sensorParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	year, month, date := time.Now().In(s.cfg.Location).AddDate(0, 0, -1).Date()
+	day := time.Date(year, month, date, 0, 0, 0, 0, s.cfg.Location)
+
+	if value := r.URL.Query().Get("date"); value != "" {
+
+		parsed, err := time.ParseInLocation(rollupDateLayout, value, s.cfg.Location)
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid date"))
+			return
+		}
+
+		day = parsed
+
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	summary, err := s.writeRollup(ctx, site, sensor, day)
+
+	if err != nil {
+		slog.Error("write rollup", "op", "rollup", "collection", s.cfg.Collections.TemperatureDaily, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"site":        site,
+		"sensor":      sensor,
+		"date":        day.Format(rollupDateLayout),
+		"temperature": summary,
+	})
+
+}
+
+func (s *Server) writeRollup(ctx context.Context, site, sensor string, day time.Time) (summary TemperatureSummary, err error) {
+
+	defer observeFirestore("rollup", time.Now())
+
+	slots, err := s.readTemperatures(ctx, site, sensor)
+
+	if err != nil {
+		return
+	}
+
+	summary = summarizeTemperatures(daySlots(slots, day))
+
+	// Zero values would read as a real 0°C day.
+	if summary.Samples == 0 {
+		slog.Warn("no readings to roll up", "op", "rollup", "site", site, "sensor", sensor, "date", day.Format(rollupDateLayout))
+		return
+	}
+
+	doc := s.sensorCollection(site, sensor, s.cfg.Collections.TemperatureDaily).Doc(day.Format(rollupDateLayout))
+
+	err = s.retry(ctx, func() (err error) {
+		_, err = doc.Set(ctx, map[string]interface{}{
+			"date":    day,
+			"min":     summary.Min,
+			"max":     summary.Max,
+			"mean":    summary.Avg,
+			"samples": summary.Samples,
+		})
+		return
+	})
+
+	return
+
+}
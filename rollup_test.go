@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDaySlots(t *testing.T) {
+
+	day := time.Date(2023, 4, 10, 15, 30, 0, 0, defaultTimeZone)
+	slot := func(hour time.Time, adj float64) map[string]interface{} {
+		return map[string]interface{}{"hour": hour, "adj_temperature": adj}
+	}
+
+	slots := []interface{}{
+		slot(time.Date(2023, 4, 10, 0, 0, 0, 0, defaultTimeZone), 20),
+		slot(time.Date(2023, 4, 10, 23, 0, 0, 0, defaultTimeZone), 26),
+		slot(time.Date(2023, 4, 9, 23, 0, 0, 0, defaultTimeZone), 40),
+		slot(time.Date(2023, 4, 11, 0, 0, 0, 0, defaultTimeZone), 10),
+		// 05:00 UTC is still the 9th in CST.
+		slot(time.Date(2023, 4, 10, 5, 0, 0, 0, time.UTC), 50),
+		int64(0),
+		nil,
+		map[string]interface{}{"adj_temperature": 30.0},
+	}
+
+	summary := summarizeTemperatures(daySlots(slots, day))
+
+	if summary.Samples != 2 || summary.Min != 20 || summary.Max != 26 || summary.Avg != 23 {
+		t.Errorf("summary = %+v, want 2 samples of 20..26 averaging 23", summary)
+	}
+
+}
+
+func TestRollupInvalidSensor(t *testing.T) {
+
+	s := &Server{}
+	w := httptest.NewRecorder()
+	s.rollup(w, httptest.NewRequest("POST", "/rollup?site=room-1&sensor=rack/2", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+}
+
+func TestWriteRollupSensor(t *testing.T) {
+
+	s := newTestServer(t)
+	ctx := context.Background()
+
+	for _, sensor := range []string{defaultSensor, "rack-2"} {
+
+		s.sensorCollection("rollup-site", sensor, s.cfg.Collections.Temperatures).Doc("values").Delete(ctx)
+		s.sensorCollection("rollup-site", sensor, s.cfg.Collections.TemperatureDaily).Doc(time.Now().In(s.cfg.Location).Format(rollupDateLayout)).Delete(ctx)
+
+	}
+
+	if _, err := s.writeTemperature(ctx, LogTemperature{SiteID: "rollup-site", SensorID: "rack-2", AdjTemperature: 24, AvgTemperature: 24}); err != nil {
+		t.Fatal(err)
+	}
+
+	year, month, date := time.Now().In(s.cfg.Location).Date()
+	day := time.Date(year, month, date, 0, 0, 0, 0, s.cfg.Location)
+
+	if summary, err := s.writeRollup(ctx, "rollup-site", "rack-2", day); err != nil || summary.Samples != 1 || summary.Avg != 24 {
+		t.Fatalf("rack-2 writeRollup() = %+v, %v; want one sample of 24", summary, err)
+	}
+
+	doc, err := s.sensorCollection("rollup-site", "rack-2", s.cfg.Collections.TemperatureDaily).Doc(day.Format(rollupDateLayout)).Get(ctx)
+
+	if err != nil {
+		t.Fatalf("rack-2 rollup not stored: %v", err)
+	}
+
+	if samples, _ := doc.DataAt("samples"); samples != int64(1) {
+		t.Errorf("stored samples = %v, want 1", samples)
+	}
+
+	// The default sensor has no readings of its own, so nothing is stored.
+	if summary, err := s.writeRollup(ctx, "rollup-site", defaultSensor, day); err != nil || summary.Samples != 0 {
+		t.Errorf("default writeRollup() = %+v, %v; want no samples", summary, err)
+	}
+
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errUnknownSchema is returned when a payload names a schema version this
+// server can't decode.
+var errUnknownSchema = errors.New("unknown schema version")
+
+// errUnknownField is returned for a payload with a field the schema doesn't
+// have, usually a misspelled one.
+var errUnknownField = errors.New("unknown field")
+
+// errTrailingData is returned for a body with more than one JSON value.
+var errTrailingData = errors.New("unexpected data after the JSON value")
+
+// unknownFieldPrefix starts encoding/json's error for a field the target
+// doesn't have; it has no error type for this case.
+const unknownFieldPrefix = "json: unknown field "
+
+// decodeStrict decodes body into v, rejecting fields v doesn't have and
+// anything but whitespace after the value.
+func decodeStrict(body []byte, v interface{}) error {
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+
+	if field, ok := strings.CutPrefix(fmt.Sprint(err), unknownFieldPrefix); ok {
+		return fmt.Errorf("%w %s", errUnknownField, field)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return errTrailingData
+	}
+
+	return nil
+
+}
+
+// payloadSchema returns the "schema" version of a JSON object, 1 when the
+// field is absent, as sent by firmware predating versioning.
+func payloadSchema(body []byte) (int, error) {
+
+	probe := struct {
+		Schema *int `json:"schema"`
+	}{}
+
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return 0, err
+	}
+
+	if probe.Schema == nil {
+		return 1, nil
+	}
+
+	return *probe.Schema, nil
+
+}
+
+// decodeAmbient decodes an Ambient according to its schema version. New
+// versions get their own case so old devices keep working.
+func decodeAmbient(body []byte) (ambient Ambient, err error) {
+
+	version, err := payloadSchema(body)
+
+	if err != nil {
+		return
+	}
+
+	switch version {
+	case 1:
+		err = decodeStrict(body, &ambient)
+	default:
+		return ambient, fmt.Errorf("%w %d", errUnknownSchema, version)
+	}
+
+	ambient.Schema = version
+
+	if ambient.SensorID == "" {
+		ambient.SensorID = defaultSensor
+	}
+
+	return
+
+}
+
+// decodeLogTemperature decodes a LogTemperature according to its schema
+// version.
+func decodeLogTemperature(body []byte) (temp LogTemperature, err error) {
+
+	version, err := payloadSchema(body)
+
+	if err != nil {
+		return
+	}
+
+	switch version {
+	case 1:
+		err = decodeStrict(body, &temp)
+	default:
+		return temp, fmt.Errorf("%w %d", errUnknownSchema, version)
+	}
+
+	temp.Schema = version
+
+	if temp.SensorID == "" {
+		temp.SensorID = defaultSensor
+	}
+
+	return
+
+}
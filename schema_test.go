@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPayloadSchema(t *testing.T) {
+
+	cases := []struct {
+		body string
+		want int
+	}{
+		{`{"temp": 20}`, 1},
+		{`{"schema": 1, "temp": 20}`, 1},
+		{`{"schema": 2}`, 2},
+	}
+
+	for _, c := range cases {
+
+		got, err := payloadSchema([]byte(c.body))
+
+		if err != nil || got != c.want {
+			t.Errorf("payloadSchema(%s) = %d, %v; want %d", c.body, got, err, c.want)
+		}
+
+	}
+
+}
+
+func TestDecodeAmbientSchema(t *testing.T) {
+
+	ambient, err := decodeAmbient([]byte(`{"siteId": "s1", "temperature": 21.5}`))
+
+	if err != nil || ambient.SiteID != "s1" || ambient.Temperature != 21.5 || ambient.Schema != 1 {
+		t.Errorf("decodeAmbient v1 = %+v, %v", ambient, err)
+	}
+
+	if ambient.SensorID != defaultSensor {
+		t.Errorf("decodeAmbient without sensorId = %q, want %q", ambient.SensorID, defaultSensor)
+	}
+
+	if ambient, _ := decodeAmbient([]byte(`{"siteId": "s1", "sensorId": "rack-2"}`)); ambient.SensorID != "rack-2" {
+		t.Errorf("decodeAmbient sensorId = %q, want rack-2", ambient.SensorID)
+	}
+
+	if _, err := decodeAmbient([]byte(`{"schema": 9, "siteId": "s1"}`)); !errors.Is(err, errUnknownSchema) {
+		t.Errorf("decodeAmbient v9 err = %v, want errUnknownSchema", err)
+	}
+
+}
+
+func TestDecodeLogTemperatureSchema(t *testing.T) {
+
+	temp, err := decodeLogTemperature([]byte(`{"siteId": "s1", "avg_temperature": 4}`))
+
+	if err != nil || temp.SiteID != "s1" || temp.AvgTemperature != 4 || temp.Schema != 1 {
+		t.Errorf("decodeLogTemperature v1 = %+v, %v", temp, err)
+	}
+
+	if temp.SensorID != defaultSensor {
+		t.Errorf("decodeLogTemperature without sensorId = %q, want %q", temp.SensorID, defaultSensor)
+	}
+
+	if _, err := decodeLogTemperature([]byte(`{"schema": 0}`)); !errors.Is(err, errUnknownSchema) {
+		t.Errorf("decodeLogTemperature v0 err = %v, want errUnknownSchema", err)
+	}
+
+}
+
+func TestDecodeUnknownField(t *testing.T) {
+
+	_, err := decodeAmbient([]byte(`{"siteId": "s1", "temperatur": 21.5}`))
+
+	if !errors.Is(err, errUnknownField) || err.Error() != `unknown field "temperatur"` {
+		t.Errorf("decodeAmbient err = %v, want the unknown field named", err)
+	}
+
+	if _, err := decodeLogTemperature([]byte(`{"siteId": "s1", "avg_temp": 4}`)); !errors.Is(err, errUnknownField) {
+		t.Errorf("decodeLogTemperature err = %v, want errUnknownField", err)
+	}
+
+}
+
+func TestUnknownFieldPrefix(t *testing.T) {
+
+	// decodeStrict matches encoding/json's message, so a Go release that
+	// rewords it must fail here rather than turn 400s into generic errors.
+	decoder := json.NewDecoder(strings.NewReader(`{"temperatur": 21.5}`))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&Ambient{}); err == nil || err.Error() != unknownFieldPrefix+`"temperatur"` {
+		t.Errorf("encoding/json err = %v, want %q", err, unknownFieldPrefix+`"temperatur"`)
+	}
+
+}
+
+func TestDecodeStrictTrailingData(t *testing.T) {
+
+	tests := []struct {
+		body    string
+		wantErr error
+	}{
+		{`{"siteId":"a"}`, nil},
+		{"{\"siteId\":\"a\"}\n", nil},
+		{`{"siteId":"a"} garbage`, errTrailingData},
+		{`{"siteId":"a"}{"siteId":"b"}`, errTrailingData},
+		{`{"siteId":"a"}}`, errTrailingData},
+	}
+
+	for _, tt := range tests {
+
+		var ambient Ambient
+
+		if err := decodeStrict([]byte(tt.body), &ambient); !errors.Is(err, tt.wantErr) {
+			t.Errorf("decodeStrict(%q) = %v, want %v", tt.body, err, tt.wantErr)
+		}
+
+	}
+
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const alertOffline = "offline"
+
+// heartbeat records that the site's sensor reported, in sensors/{site}.
+// Failures are only logged; a missed heartbeat must not fail the reading.
+func (s *Server) heartbeat(ctx context.Context, site string) {
+
+	err := s.retry(ctx, func() (err error) {
+		_, err = s.fs.Collection(s.cfg.Collections.Sensors).Doc(site).Set(ctx, map[string]interface{}{
+			"siteId":   site,
+			"lastSeen": firestore.ServerTimestamp,
+		}, firestore.MergeAll)
+		return
+	})
+
+	if err != nil {
+		slog.Error("write heartbeat", "op", "heartbeat", "collection", s.cfg.Collections.Sensors, "doc", site, "err", err)
+	}
+
+}
+
+// staleMinutes returns how many whole minutes ago lastSeen was and whether
+// that exceeds the stale threshold.
+func staleMinutes(lastSeen, now time.Time, stale time.Duration) (int, bool) {
+
+	since := now.Sub(lastSeen)
+	return int(since / time.Minute), since > stale
+
+}
+
+// StaleSensor is a sensor reported by /checkSensors.
+type StaleSensor struct {
+	SiteID  string `json:"siteId"`
+	Minutes int    `json:"minutes"`
+	Sent    int    `json:"sent"`
+	Status  string `json:"status,omitempty"`
+}
+
+// checkSensors sends a "sensor offline" alert for every site whose last
+// heartbeat is older than SENSOR_STALE_MINUTES. It is meant to be triggered
+// by a scheduler; the usual per-site cooldown keeps a dead sensor from
+// alerting on every run.
+func (s *Server) checkSensors(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	var docs []*firestore.DocumentSnapshot
+
+	err := s.retry(ctx, func() (err error) {
+		docs, err = s.fs.Collection(s.cfg.Collections.Sensors).Documents(ctx).GetAll()
+		return
+	})
+
+	if err != nil {
+		slog.Error("list sensors", "op", "checkSensors", "collection", s.cfg.Collections.Sensors, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	msgs := messages[s.cfg.Locale]
+	stale := []StaleSensor{}
+
+	for _, doc := range docs {
+
+		lastSeen, ok := doc.Data()["lastSeen"].(time.Time)
+
+		if !ok {
+			slog.Warn("skip malformed sensor doc", "op", "checkSensors", "doc", doc.Ref.ID)
+			continue
+		}
+
+		minutes, isStale := staleMinutes(lastSeen, now, s.cfg.SensorStale)
+
+		if !isStale {
+			continue
+		}
+
+		site := doc.Ref.ID
+		sensor := StaleSensor{SiteID: site, Minutes: minutes}
+		key := alertKey(site, alertOffline)
+
+		if s.inCooldown(key, now) {
+			sensor.Status = "cooldown"
+			stale = append(stale, sensor)
+			continue
+		}
+
+		result, err := s.broadcast(ctx, site, alertOffline, map[string]string{
+			"Title":    siteTitle(site, msgs.SensorOfflineTitle),
+			"Body":     fmt.Sprintf(msgs.SensorOfflineBody, minutes),
+			"Site":     site,
+			"Severity": severityCritical,
+			"type":     typeOffline,
+		})
+
+		if err != nil {
+			slog.Error("send offline alert", "op", "checkSensors", "site", site, "err", err)
+			sensor.Status = "failed"
+		} else {
+			s.markSent(key, now)
+		}
+
+		sensor.Sent = result.Sent
+		stale = append(stale, sensor)
+
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"stale": stale})
+
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStaleMinutes(t *testing.T) {
+
+	now := time.Date(2023, 4, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		lastSeen    time.Time
+		wantMinutes int
+		wantStale   bool
+	}{
+		{now.Add(-time.Minute), 1, false},
+		{now.Add(-15 * time.Minute), 15, false},
+		{now.Add(-15*time.Minute - time.Second), 15, true},
+		{now.Add(-3 * time.Hour), 180, true},
+	}
+
+	for _, tt := range tests {
+
+		minutes, stale := staleMinutes(tt.lastSeen, now, 15*time.Minute)
+
+		if minutes != tt.wantMinutes || stale != tt.wantStale {
+			t.Errorf("staleMinutes(%v) = %d, %v; want %d, %v", tt.lastSeen, minutes, stale, tt.wantMinutes, tt.wantStale)
+		}
+
+	}
+
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/messaging"
+)
+
+// Alert severities, also used as the Android notification channel IDs.
+const (
+	severityInfo     = "info"
+	severityWarning  = "warning"
+	severityCritical = "critical"
+)
+
+// Margins past a threshold, in °C, at which an alert escalates.
+const (
+	warningMargin  = 2.0
+	criticalMargin = 5.0
+)
+
+// severity grades a reading by how far it is past its thresholds. Humidity
+// outside its band is a warning, and movement is never below a warning.
+func (c Config) severity(ambient Ambient) string {
+
+	excess := ambient.Temperature - c.TempMax
+
+	if heat := ambient.HeatIndex - c.HeatIndexMax; heat > excess {
+		excess = heat
+	}
+
+	switch {
+	case excess >= criticalMargin:
+		return severityCritical
+	case excess >= warningMargin, ambient.Movement > 0:
+		return severityWarning
+	case ambient.Humidity > c.HumidityMax || ambient.Humidity < c.HumidityMin:
+		return severityWarning
+	}
+
+	return severityInfo
+
+}
+
+// androidStyle is how one notification type is delivered. An empty channel
+// falls back to the severity, an empty priority is high, and FCM drops a
+// message not delivered within TTL; 0 leaves FCM's default.
+type androidStyle struct {
+	Channel  string
+	Sound    string
+	Priority string
+	TTL      time.Duration
+}
+
+// loadAndroidStyles reads ANDROID_CHANNEL_<TYPE>, ANDROID_SOUND_<TYPE> and
+// NOTIFICATION_TTL_<TYPE> for every notification type, e.g.
+// ANDROID_SOUND_MOVEMENT. NOTIFICATION_PRIORITY and NOTIFICATION_TTL apply to
+// every type.
+func loadAndroidStyles() (styles map[string]androidStyle, err error) {
+
+	priority := strings.ToLower(envString("NOTIFICATION_PRIORITY", "high"))
+
+	if priority != "high" && priority != "normal" {
+		return nil, fmt.Errorf("invalid NOTIFICATION_PRIORITY %q: must be high or normal", priority)
+	}
+
+	ttl, err := envDuration("NOTIFICATION_TTL", time.Hour)
+
+	if err != nil {
+		return
+	}
+
+	styles = map[string]androidStyle{}
+
+	for _, kind := range []string{typeAmbient, typeMovement, typeSummary, typeOffline, typeRising} {
+
+		suffix := strings.ToUpper(kind)
+		style := androidStyle{
+			Channel:  os.Getenv("ANDROID_CHANNEL_" + suffix),
+			Sound:    envString("ANDROID_SOUND_"+suffix, "default"),
+			Priority: priority,
+		}
+
+		if style.TTL, err = envDuration("NOTIFICATION_TTL_"+suffix, ttl); err != nil {
+			return nil, err
+		}
+
+		styles[kind] = style
+
+	}
+
+	return
+
+}
+
+// androidConfig returns the FCM Android options for a severity and the style
+// of the notification type. Info alerts always go out at normal priority,
+// and a message without a channel or sound keeps the app's defaults.
+func androidConfig(severity string, style androidStyle) *messaging.AndroidConfig {
+
+	android := &messaging.AndroidConfig{Priority: "high"}
+
+	if style.Priority != "" {
+		android.Priority = style.Priority
+	}
+
+	if severity == severityInfo {
+		android.Priority = "normal"
+	}
+
+	if style.TTL > 0 {
+		ttl := style.TTL
+		android.TTL = &ttl
+	}
+
+	channel := style.Channel
+
+	if channel == "" {
+		channel = severity
+	}
+
+	if channel != "" || style.Sound != "" {
+		android.Notification = &messaging.AndroidNotification{ChannelID: channel, Sound: style.Sound}
+	}
+
+	return android
+
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeverity(t *testing.T) {
+
+	cfg := Config{TempMax: 30, HeatIndexMax: 40, HumidityMax: 70, HumidityMin: 20}
+
+	tests := []struct {
+		name    string
+		ambient Ambient
+		want    string
+	}{
+		{"slightly warm", Ambient{Temperature: 31, Humidity: 40, HeatIndex: 32}, severityInfo},
+		{"warm", Ambient{Temperature: 32.5, Humidity: 40, HeatIndex: 34}, severityWarning},
+		{"hot", Ambient{Temperature: 35, Humidity: 40, HeatIndex: 37}, severityCritical},
+		{"heat index", Ambient{Temperature: 29, Humidity: 90, HeatIndex: 46}, severityCritical},
+		{"humid", Ambient{Temperature: 24, Humidity: 80, HeatIndex: 25}, severityWarning},
+		{"dry", Ambient{Temperature: 24, Humidity: 10, HeatIndex: 23}, severityWarning},
+		{"movement", Ambient{Temperature: 24, Humidity: 40, HeatIndex: 25, Movement: 1}, severityWarning},
+		{"movement while hot", Ambient{Temperature: 36, Humidity: 40, HeatIndex: 38, Movement: 1}, severityCritical},
+	}
+
+	for _, tt := range tests {
+
+		if got := cfg.severity(tt.ambient); got != tt.want {
+			t.Errorf("%s: severity() = %q, want %q", tt.name, got, tt.want)
+		}
+
+	}
+
+}
+
+func TestAndroidConfig(t *testing.T) {
+
+	tests := []struct {
+		severity     string
+		wantPriority string
+		wantChannel  string
+	}{
+		{severityInfo, "normal", "info"},
+		{severityWarning, "high", "warning"},
+		{severityCritical, "high", "critical"},
+		{"", "high", ""},
+	}
+
+	for _, tt := range tests {
+
+		android := androidConfig(tt.severity, androidStyle{})
+		channel := ""
+
+		if android.Notification != nil {
+			channel = android.Notification.ChannelID
+		}
+
+		if android.Priority != tt.wantPriority || channel != tt.wantChannel {
+			t.Errorf("androidConfig(%q) = %s/%q, want %s/%q", tt.severity, android.Priority, channel, tt.wantPriority, tt.wantChannel)
+		}
+
+	}
+
+}
+
+func TestAndroidConfigStyle(t *testing.T) {
+
+	android := androidConfig(severityWarning, androidStyle{Channel: "movement", Sound: "chime"})
+
+	if n := android.Notification; n == nil || n.ChannelID != "movement" || n.Sound != "chime" {
+		t.Errorf("notification = %+v, want channel movement and sound chime", n)
+	}
+
+	android = androidConfig(severityCritical, androidStyle{Sound: "siren"})
+
+	if n := android.Notification; n == nil || n.ChannelID != severityCritical || n.Sound != "siren" {
+		t.Errorf("notification = %+v, want the severity channel and sound siren", n)
+	}
+
+}
+
+func TestAndroidConfigDelivery(t *testing.T) {
+
+	android := androidConfig(severityWarning, androidStyle{Priority: "normal", TTL: 10 * time.Minute})
+
+	if android.Priority != "normal" || android.TTL == nil || *android.TTL != 10*time.Minute {
+		t.Errorf("android = %s/%v, want normal priority and a 10m TTL", android.Priority, android.TTL)
+	}
+
+	if android := androidConfig(severityCritical, androidStyle{}); android.Priority != "high" || android.TTL != nil {
+		t.Errorf("default android = %s/%v, want high priority and no TTL", android.Priority, android.TTL)
+	}
+
+}
+
+func TestLoadAndroidStylesTTL(t *testing.T) {
+
+	t.Setenv("NOTIFICATION_TTL", "2h")
+	t.Setenv("NOTIFICATION_TTL_MOVEMENT", "5m")
+	t.Setenv("NOTIFICATION_PRIORITY", "normal")
+
+	styles, err := loadAndroidStyles()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if styles[typeAmbient].TTL != 2*time.Hour || styles[typeMovement].TTL != 5*time.Minute {
+		t.Errorf("TTLs = %v/%v, want 2h for ambient and 5m for movement", styles[typeAmbient].TTL, styles[typeMovement].TTL)
+	}
+
+	if styles[typeOffline].Priority != "normal" {
+		t.Errorf("priority = %q, want normal", styles[typeOffline].Priority)
+	}
+
+	t.Setenv("NOTIFICATION_PRIORITY", "urgent")
+
+	if _, err := loadAndroidStyles(); err == nil {
+		t.Error("invalid NOTIFICATION_PRIORITY accepted")
+	}
+
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// SimulateRequest is the body of POST /simulate. Type is "temperature" or
+// "movement"; the readings default to a critical temperature at 50%
+// humidity.
+type SimulateRequest struct {
+	Type           string   `json:"type"`
+	SiteID         string   `json:"siteId"`
+	Temperature    *float64 `json:"temperature"`
+	Humidity       *float64 `json:"humidity"`
+	BypassCooldown bool     `json:"bypassCooldown"`
+}
+
+// simulate sends a test alert for a synthetic reading through the same path
+// as /sendAll, for checking the notification pipeline without a sensor.
+// Nothing is stored, the body is prefixed with [TEST], and test alerts never
+// start or count against the cooldown of real ones.
+func (s *Server) simulate(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	req := SimulateRequest{}
+
+	if err := s.decodeJSON(w, r, &req); err != nil {
+
+		if isTooLarge(err) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write([]byte("Body too large"))
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Missing data"))
+		return
+
+	}
+
+	if req.Type != alertTemperature && req.Type != alertMovement {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`type must be "temperature" or "movement"`))
+		return
+	}
+
+	ambient := Ambient{SiteID: req.SiteID, Temperature: s.cfg.TempMax + criticalMargin, Humidity: 50}
+
+	if req.Temperature != nil {
+		ambient.Temperature = *req.Temperature
+	}
+
+	if req.Humidity != nil {
+		ambient.Humidity = *req.Humidity
+	}
+
+	if req.Type == alertMovement {
+		ambient.Movement = 1
+	}
+
+	ambient.HeatIndex = computeHeatIndex(ambient.Temperature, ambient.Humidity)
+	ambient.DewPoint = computeDewPoint(ambient.Temperature, ambient.Humidity)
+
+	if err := ambient.validate(); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	result, err := s.deliverAlert(ctx, ambient, alertOptions{test: true, skipCooldown: req.BypassCooldown})
+
+	if errors.Is(err, errWithinThresholds) || errors.Is(err, errCooldown) || errors.Is(err, errQuietHours) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if err != nil {
+		slog.Error("send test alert", "op", "simulate", "site", ambient.SiteID, "type", req.Type, "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+
+}
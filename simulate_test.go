@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSimulate(t *testing.T) {
+
+	fcm := &fakeNotifier{}
+	s := &Server{
+		cfg: Config{
+			TempMax:      30,
+			HeatIndexMax: 40,
+			HumidityMax:  70,
+			Cooldown:     time.Minute,
+			Location:     defaultTimeZone,
+			TempUnit:     "C",
+			Locale:       "es",
+			UseTopic:     true,
+			TopicName:    "alerts",
+			MaxBodyBytes: 1 << 10,
+		},
+		fcm:      fcm,
+		lastSent: map[string]time.Time{},
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"temperature", `{"type":"temperature","siteId":"room-1"}`, http.StatusOK},
+		{"cooldown", `{"type":"temperature","siteId":"room-1"}`, http.StatusConflict},
+		{"bypass cooldown", `{"type":"temperature","siteId":"room-1","bypassCooldown":true}`, http.StatusOK},
+		{"movement", `{"type":"movement","siteId":"room-1"}`, http.StatusOK},
+		{"within thresholds", `{"type":"temperature","siteId":"room-2","temperature":20}`, http.StatusConflict},
+		{"unknown type", `{"type":"smoke","siteId":"room-1"}`, http.StatusBadRequest},
+		{"missing site", `{"type":"movement"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+
+		w := httptest.NewRecorder()
+		s.simulate(w, httptest.NewRequest("POST", "/simulate", strings.NewReader(tt.body)))
+
+		if w.Code != tt.want {
+			t.Fatalf("%s: status = %d (%s), want %d", tt.name, w.Code, w.Body.String(), tt.want)
+		}
+
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var result SendResult
+
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil || result.Sent != 1 {
+			t.Errorf("%s: result = %+v, %v; want 1 sent", tt.name, result, err)
+		}
+
+	}
+
+	if len(fcm.sent) != 3 {
+		t.Fatalf("%d alerts sent, want 3", len(fcm.sent))
+	}
+
+	if body := fcm.sent[0].Data["Body"]; !strings.HasPrefix(body, testPrefix) {
+		t.Errorf("body = %q, want the %q prefix", body, testPrefix)
+	}
+
+	// Test alerts leave the real cooldown alone.
+	if s.inCooldown(alertKey("room-1", alertTemperature), time.Now()) {
+		t.Error("test alert started the real cooldown")
+	}
+
+}
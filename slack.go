@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// slackColors maps a severity to its Slack attachment color.
+var slackColors = map[string]string{
+	severityInfo:     "good",
+	severityWarning:  "warning",
+	severityCritical: "danger",
+}
+
+// slackMessage is the body of a Slack incoming-webhook request.
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Fields []slackField `json:"fields"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// slackAlert formats the alert for a reading as a Slack message.
+func slackAlert(ambient Ambient, c Config) slackMessage {
+
+	msgs := messages[c.Locale]
+	title := msgs.AmbientTitle
+
+	if ambient.Movement > 0 {
+		title = msgs.MovementTitle
+	}
+
+	fields := []slackField{
+		{Title: msgs.TemperatureLbl, Value: formatTemperature(ambient.Temperature, c.TempUnit), Short: true},
+		{Title: msgs.HumidityLbl, Value: fmt.Sprintf("%.0f%%", ambient.Humidity), Short: true},
+	}
+
+	if value := heatIndexValue(ambient, c, msgs); value != "" {
+		fields = append(fields, slackField{Title: msgs.HeatIndexLbl, Value: value, Short: true})
+	}
+
+	return slackMessage{
+		Text: fmt.Sprintf("*%s*", siteTitle(ambient.source(), title)),
+		Attachments: []slackAttachment{{
+			Color:  slackColors[c.severity(ambient)],
+			Fields: fields,
+		}},
+	}
+
+}
+
+// sendSlackAlert mirrors the alert for a reading to SLACK_WEBHOOK_URL.
+func (s *Server) sendSlackAlert(ctx context.Context, ambient Ambient) error {
+
+	return s.postJSON(ctx, s.cfg.SlackWebhookURL, slackAlert(ambient, s.cfg))
+
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSlackAlert(t *testing.T) {
+
+	cfg := Config{TempMax: 30, HeatIndexMax: 40, HumidityMax: 70, TempUnit: "C", Locale: "en"}
+
+	tests := []struct {
+		name      string
+		ambient   Ambient
+		wantText  string
+		wantColor string
+	}{
+		{"mild", Ambient{SiteID: "room-1", Temperature: 31, Humidity: 40, HeatIndex: 32}, "*[room-1] Ambient Alert*", "good"},
+		{"hot", Ambient{SiteID: "room-1", Temperature: 36, Humidity: 40, HeatIndex: 38}, "*[room-1] Ambient Alert*", "danger"},
+		{"muggy", Ambient{SiteID: "room-1", Temperature: 32, Humidity: 90, HeatIndex: 46}, "*[room-1] Ambient Alert*", "danger"},
+		{"movement", Ambient{SiteID: "room-1", Temperature: 24, Humidity: 40, HeatIndex: 25, Movement: 1}, "*[room-1] Someone has entered the site!*", "warning"},
+	}
+
+	for _, tt := range tests {
+
+		msg := slackAlert(tt.ambient, cfg)
+
+		if msg.Text != tt.wantText || len(msg.Attachments) != 1 || msg.Attachments[0].Color != tt.wantColor {
+			t.Errorf("%s: slackAlert() = %+v, want %q colored %q", tt.name, msg, tt.wantText, tt.wantColor)
+		}
+
+	}
+
+}
+
+func TestSendSlackAlert(t *testing.T) {
+
+	messagesSent := make(chan slackMessage, 1)
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var msg slackMessage
+
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("decode slack body: %v", err)
+		}
+
+		messagesSent <- msg
+
+	}))
+	defer hook.Close()
+
+	s := &Server{cfg: Config{TempMax: 30, HeatIndexMax: 40, TempUnit: "C", Locale: "es", SlackWebhookURL: hook.URL, WebhookTimeout: time.Second}}
+
+	if err := s.sendSlackAlert(context.Background(), Ambient{SiteID: "room-1", Temperature: 31, Humidity: 40, HeatIndex: 32}); err != nil {
+		t.Fatalf("sendSlackAlert() error = %v", err)
+	}
+
+	msg := <-messagesSent
+
+	if fields := msg.Attachments[0].Fields; len(fields) != 3 || fields[0].Value != "31.00°C" || fields[1].Value != "40%" {
+		t.Errorf("fields = %+v", fields)
+	}
+
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"cloud.google.com/go/firestore"
+)
+
+// stream pushes a site's ambient readings, or the ?sensor= one's, to the
+// client as Server-Sent Events, starting with the latest stored one. The
+// Firestore listener is stopped when the client disconnects. At most
+// StreamMax streams are served at once.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	site, ok := siteParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	sensor, ok := sensorParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Streaming unsupported"))
+		return
+	}
+
+	if n := s.streams.Add(1); int(n) > s.cfg.StreamMax {
+		s.streams.Add(-1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("Too many streams"))
+		return
+	}
+
+	defer s.streams.Add(-1)
+
+	ctx := r.Context()
+
+	snapshots := s.sensorCollection(site, sensor, s.cfg.Collections.Ambient).
+		OrderBy("timestamp", firestore.Desc).
+		Limit(1).
+		Snapshots(ctx)
+	defer snapshots.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+
+		snapshot, err := snapshots.Next()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			slog.Error("listen ambient", "op", "stream", "collection", s.cfg.Collections.Ambient, "err", err)
+			return
+		}
+
+		for _, change := range snapshot.Changes {
+
+			if change.Kind != firestore.DocumentAdded {
+				continue
+			}
+
+			reading := AmbientReading{}
+
+			if err := change.Doc.DataTo(&reading); err != nil {
+				slog.Warn("skip malformed ambient doc", "op", "stream", "doc", change.Doc.Ref.ID, "err", err)
+				continue
+			}
+
+			frame, err := json.Marshal(reading)
+
+			if err != nil {
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", frame); err != nil {
+				return
+			}
+
+			flusher.Flush()
+
+		}
+
+	}
+
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamInvalidSensor(t *testing.T) {
+
+	s := &Server{cfg: Config{StreamMax: 1}}
+	w := httptest.NewRecorder()
+	s.stream(w, httptest.NewRequest("GET", "/stream?site=room-1&sensor=rack/2", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	if n := s.streams.Load(); n != 0 {
+		t.Errorf("streams = %d after rejecting, want 0", n)
+	}
+
+}
+
+func TestStreamLimit(t *testing.T) {
+
+	s := &Server{cfg: Config{StreamMax: 1}}
+	s.streams.Store(1)
+
+	w := httptest.NewRecorder()
+	s.stream(w, httptest.NewRequest("GET", "/stream?site=room-1", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	if n := s.streams.Load(); n != 1 {
+		t.Errorf("streams = %d after rejecting, want 1", n)
+	}
+
+}
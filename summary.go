@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const alertSummary = "summary"
+
+// TemperatureSummary aggregates the adjusted temperatures of the filled
+// hourly slots in the Temperatures array.
+type TemperatureSummary struct {
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Avg     float64 `json:"avg"`
+	Samples int     `json:"samples"`
+}
+
+// slotValue returns the numeric field key of a stored hourly slot. Empty
+// slots are stored as a plain 0 and report false.
+func slotValue(slot interface{}, key string) (float64, bool) {
+
+	m, ok := slot.(map[string]interface{})
+
+	if !ok {
+		return 0, false
+	}
+
+	switch v := m[key].(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	}
+
+	return 0, false
+
+}
+
+func summarizeTemperatures(slots []interface{}) (summary TemperatureSummary) {
+
+	total := 0.0
+
+	for _, slot := range slots {
+
+		value, ok := slotValue(slot, "adj_temperature")
+
+		if !ok {
+			continue
+		}
+
+		if summary.Samples == 0 || value < summary.Min {
+			summary.Min = value
+		}
+
+		if summary.Samples == 0 || value > summary.Max {
+			summary.Max = value
+		}
+
+		total += value
+		summary.Samples++
+
+	}
+
+	if summary.Samples > 0 {
+		summary.Avg = total / float64(summary.Samples)
+	}
+
+	return
+
+}
+
+// countMoves returns the number of movement events logged for t's day.
+func (s *Server) countMoves(ctx context.Context, site string, t time.Time) (int, error) {
+
+	snapshot, err := s.collection(site, s.cfg.Collections.Movement).Doc(movementDocID(t)).Get(ctx)
+
+	if status.Code(err) == codes.NotFound {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	moves, _ := snapshot.DataAt("move_logs")
+	logs, _ := moves.([]interface{})
+
+	return len(logs), nil
+
+}
+
+// dailySummary sends a digest of the site's stored 24-hour temperatures, the
+// ?sensor= one's for a named sensor, and today's movement count. It is meant
+// to be triggered once a day per site by a scheduler, e.g. POST
+// /dailySummary?site=room-1.
+func (s *Server) dailySummary(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	site, ok := siteParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	sensor, ok := sensorParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	slots, err := s.readTemperatures(ctx, site, sensor)
+
+	if err != nil {
+		slog.Error("read temperatures", "op", "dailySummary", "collection", s.cfg.Collections.Temperatures, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().In(s.cfg.Location)
+	// The rolling array still holds the previous day's readings for the
+	// hours not yet reached.
+	summary := summarizeTemperatures(daySlots(slots, now))
+
+	moves, err := s.countMoves(ctx, site, now)
+
+	if err != nil {
+		slog.Error("count movement", "op", "dailySummary", "collection", s.cfg.Collections.Movement, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	msgs := messages[s.cfg.Locale]
+
+	result, err := s.broadcast(ctx, site, alertSummary, map[string]string{
+		"Title":    siteTitle(sourceName(site, sensor), msgs.SummaryTitle),
+		"Body":     summaryBody(summary, moves, msgs, s.cfg.TempUnit),
+		"Site":     site,
+		"Severity": severityInfo,
+		"type":     typeSummary,
+	})
+
+	if err != nil {
+		slog.Error("send summary", "op", "dailySummary", "err", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"site":        site,
+		"sensor":      sensor,
+		"temperature": summary,
+		"movements":   moves,
+		"sent":        result.Sent,
+		"failed":      result.Failed,
+	})
+
+}
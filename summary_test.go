@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDailySummaryInvalidSensor(t *testing.T) {
+
+	s := &Server{}
+	w := httptest.NewRecorder()
+	s.dailySummary(w, httptest.NewRequest("POST", "/dailySummary?site=room-1&sensor=rack/2", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+}
+
+func TestSummarizeTemperatures(t *testing.T) {
+
+	slot := func(adj float64) interface{} {
+		return map[string]interface{}{"avg_temperature": adj + 1, "adj_temperature": adj}
+	}
+
+	tests := []struct {
+		name  string
+		slots []interface{}
+		want  TemperatureSummary
+	}{
+		{"empty", nil, TemperatureSummary{}},
+		{"all padding", []interface{}{int64(0), int64(0)}, TemperatureSummary{}},
+		{"single", []interface{}{slot(21.5)}, TemperatureSummary{Min: 21.5, Max: 21.5, Avg: 21.5, Samples: 1}},
+		{
+			"mixed",
+			[]interface{}{slot(20), int64(0), slot(26), slot(23), int64(0)},
+			TemperatureSummary{Min: 20, Max: 26, Avg: 23, Samples: 3},
+		},
+		{
+			"integer values",
+			[]interface{}{map[string]interface{}{"adj_temperature": int64(18)}, slot(22)},
+			TemperatureSummary{Min: 18, Max: 22, Avg: 20, Samples: 2},
+		},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			if got := summarizeTemperatures(tt.slots); got != tt.want {
+				t.Errorf("summarizeTemperatures() = %+v, want %+v", got, tt.want)
+			}
+
+		})
+
+	}
+
+}
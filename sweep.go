@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// sweepPageSize is how many ambient docs are deleted per batch; it must stay
+// under Firestore's 500 writes per batch.
+const sweepPageSize = 200
+
+// sweep deletes a site's ambient readings older than AmbientRetention days,
+// those of the ?sensor= one for a named sensor. It is meant to be scheduled,
+// and running it again deletes nothing new.
+func (s *Server) sweep(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	site, ok := siteParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	sensor, ok := sensorParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -s.cfg.AmbientRetention)
+	deleted, err := s.sweepAmbient(r.Context(), site, sensor, cutoff)
+
+	if err != nil {
+		slog.Error("sweep ambient", "op", "sweep", "collection", s.cfg.Collections.Ambient, "deleted", deleted, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("swept ambient", "site", site, "sensor", sensor, "cutoff", cutoff, "deleted", deleted)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"site":    site,
+		"sensor":  sensor,
+		"cutoff":  cutoff,
+		"deleted": deleted,
+	})
+
+}
+
+// sweepAmbient deletes the sensor's ambient docs written before cutoff, one
+// page per Firestore batch, each page bounded by FirestoreTimeout.
+func (s *Server) sweepAmbient(ctx context.Context, site, sensor string, cutoff time.Time) (deleted int, err error) {
+
+	query := s.sensorCollection(site, sensor, s.cfg.Collections.Ambient).
+		Where("timestamp", "<", cutoff).
+		Limit(sweepPageSize)
+
+	for {
+
+		var n int
+
+		if n, err = s.sweepPage(ctx, query); err != nil {
+			return
+		}
+
+		deleted += n
+
+		if n < sweepPageSize {
+			return
+		}
+
+	}
+
+}
+
+// sweepPage deletes one page of the query. Deleted docs drop out of the
+// query, so every page starts from the beginning again.
+func (s *Server) sweepPage(ctx context.Context, query firestore.Query) (deleted int, err error) {
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.FirestoreTimeout)
+	defer cancel()
+
+	defer observeFirestore("sweep", time.Now())
+
+	var page []*firestore.DocumentSnapshot
+
+	err = s.retry(ctx, func() (err error) {
+		page, err = query.Documents(ctx).GetAll()
+		return
+	})
+
+	if err != nil || len(page) == 0 {
+		return
+	}
+
+	batch := s.fs.Batch()
+
+	for _, doc := range page {
+		batch.Delete(doc.Ref)
+	}
+
+	err = s.retry(ctx, func() (err error) {
+		_, err = batch.Commit(ctx)
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	return len(page), nil
+
+}
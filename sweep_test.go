@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+func TestSweepInvalidSensor(t *testing.T) {
+
+	s := &Server{}
+	w := httptest.NewRecorder()
+	s.sweep(w, httptest.NewRequest("POST", "/sweep?site=room-1&sensor=rack/2", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+}
+
+func TestSweepAmbient(t *testing.T) {
+
+	s := newTestServer(t)
+	ctx := context.Background()
+
+	ambient := s.collection("sweep-site", s.cfg.Collections.Ambient)
+	rack := s.sensorCollection("sweep-site", "rack-2", s.cfg.Collections.Ambient)
+
+	for _, collection := range []*firestore.CollectionRef{ambient, rack} {
+
+		collection := collection
+		clearCollection(t, collection)
+		t.Cleanup(func() { clearCollection(t, collection) })
+
+	}
+
+	now := time.Now()
+
+	for _, collection := range []*firestore.CollectionRef{ambient, rack} {
+
+		for _, age := range []int{40, 35, 31, 2} {
+
+			_, err := collection.NewDoc().Set(ctx, map[string]interface{}{
+				"temperature": 20.0,
+				"timestamp":   now.AddDate(0, 0, -age),
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+		}
+
+	}
+
+	cutoff := now.AddDate(0, 0, -30)
+
+	if deleted, err := s.sweepAmbient(ctx, "sweep-site", defaultSensor, cutoff); err != nil || deleted != 3 {
+		t.Fatalf("sweepAmbient() = %d, %v; want 3 deleted", deleted, err)
+	}
+
+	if deleted, err := s.sweepAmbient(ctx, "sweep-site", defaultSensor, cutoff); err != nil || deleted != 0 {
+		t.Errorf("second sweepAmbient() = %d, %v; want nothing deleted", deleted, err)
+	}
+
+	// The default sensor's sweep leaves other sensors' readings alone.
+	if docs, err := rack.Documents(ctx).GetAll(); err != nil || len(docs) != 4 {
+		t.Errorf("rack-2 has %d docs, %v; want 4 untouched", len(docs), err)
+	}
+
+	if deleted, err := s.sweepAmbient(ctx, "sweep-site", "rack-2", cutoff); err != nil || deleted != 3 {
+		t.Errorf("rack-2 sweepAmbient() = %d, %v; want 3 deleted", deleted, err)
+	}
+
+	for _, collection := range []*firestore.CollectionRef{ambient, rack} {
+
+		docs, err := collection.Documents(ctx).GetAll()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(docs) != 1 {
+			t.Errorf("%s: %d docs left, want 1", collection.Path, len(docs))
+		}
+
+	}
+
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// storedHours extracts the Temperatures array from the values document. A
+// document without the field yet yields no slots; a field of any other type
+// is reported as an error.
+func storedHours(data map[string]interface{}) ([]interface{}, error) {
+
+	value, ok := data["Temperatures"]
+
+	if !ok || value == nil {
+		return nil, nil
+	}
+
+	hours, ok := value.([]interface{})
+
+	if !ok {
+		return nil, fmt.Errorf("Temperatures field is %T, not an array", value)
+	}
+
+	return hours, nil
+
+}
+
+// checkHourIndex guards the indexing of the hourly slots, so a malformed
+// array is reported instead of panicking the handler.
+func checkHourIndex(slots []interface{}, i int) error {
+
+	if len(slots) < 24 {
+		return fmt.Errorf("%d hourly slots, want 24", len(slots))
+	}
+
+	if i < 0 || i >= len(slots) {
+		return fmt.Errorf("hour index %d out of range", i)
+	}
+
+	return nil
+
+}
+
+// mergeHourSlot builds the stored object for the hour starting at hourStart.
+// The average and adjusted values always reflect the latest reading, while
+// min/max adjusted temperatures accumulate across readings of the same hour.
+// A slot left over from a previous day's hour is replaced, not merged.
+func mergeHourSlot(prev interface{}, hourStart time.Time, avg, adj float64) map[string]interface{} {
+
+	slot := map[string]interface{}{
+		"avg_temperature": avg,
+		"adj_temperature": adj,
+		"min_temperature": adj,
+		"max_temperature": adj,
+		"hour":            hourStart,
+	}
+
+	old, ok := prev.(map[string]interface{})
+
+	if !ok {
+		return slot
+	}
+
+	if at, ok := old["hour"].(time.Time); !ok || !at.Equal(hourStart) {
+		return slot
+	}
+
+	if low, ok := slotValue(old, "min_temperature"); ok && low < adj {
+		slot["min_temperature"] = low
+	}
+
+	if high, ok := slotValue(old, "max_temperature"); ok && high > adj {
+		slot["max_temperature"] = high
+	}
+
+	return slot
+
+}
+
+// Spike handling modes for TEMP_SPIKE_MODE.
+const (
+	spikeFlag = "flag"
+	spikeDrop = "drop"
+)
+
+// errSpike is returned by writeTemperature when a spike is dropped.
+var errSpike = errors.New("temperature spike dropped")
+
+// isSpike reports whether adj differs by more than delta from the adjusted
+// temperature stored for the hour before hourStart. Without a stored value
+// for that hour nothing is a spike.
+func isSpike(prev interface{}, hourStart time.Time, adj, delta float64) bool {
+
+	old, ok := prev.(map[string]interface{})
+
+	if !ok || delta <= 0 {
+		return false
+	}
+
+	if at, ok := old["hour"].(time.Time); !ok || !at.Equal(hourStart.Add(-time.Hour)) {
+		return false
+	}
+
+	value, ok := slotValue(old, "adj_temperature")
+	return ok && math.Abs(adj-value) > delta
+
+}
+
+// ema returns the exponential moving average after value, given the
+// previous average; the first value starts the average.
+func ema(prev float64, hasPrev bool, value, alpha float64) float64 {
+
+	if !hasPrev {
+		return value
+	}
+
+	return alpha*value + (1-alpha)*prev
+
+}
+
+// roundTo rounds x to the nearest value with the given number of decimals.
+func roundTo(x float64, decimals int) float64 {
+
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(x*scale) / scale
+
+}
+
+// readTemperatures returns the 24 stored hourly slots, with empty slots as
+// nil so callers can tell "no reading" apart from a reading of 0°.
+func (s *Server) readTemperatures(ctx context.Context, site, sensor string) ([]interface{}, error) {
+
+	data, err := s.sensorCollection(site, sensor, s.cfg.Collections.Temperatures).Doc("values").Get(ctx)
+
+	if status.Code(err) == codes.NotFound {
+		return make([]interface{}, 24), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := storedHours(data.Data())
+
+	if err != nil {
+		return nil, err
+	}
+
+	slots := normalizeHours(stored)
+
+	for i, slot := range slots {
+
+		if _, ok := slot.(map[string]interface{}); !ok {
+			slots[i] = nil
+		}
+
+	}
+
+	return slots, nil
+
+}
+
+func (s *Server) getTemperatures(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	site, ok := siteParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	sensor, ok := sensorParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	slots, err := s.readTemperatures(ctx, site, sensor)
+
+	if err != nil {
+		slog.Error("read temperatures", "op", "getTemperatures", "collection", s.cfg.Collections.Temperatures, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(slots)
+
+}
+
+// csvColumns are the slot fields exported by /temperatures.csv, after hour.
+var csvColumns = []string{"avg_temperature", "adj_temperature", "min_temperature", "max_temperature"}
+
+// temperatureRows lays out the hourly slots as CSV records, one per hour
+// with blank cells for a missing slot or value.
+func temperatureRows(slots []interface{}) [][]string {
+
+	rows := [][]string{append([]string{"hour"}, csvColumns...)}
+
+	for hour, slot := range slots {
+
+		row := []string{strconv.Itoa(hour)}
+
+		for _, column := range csvColumns {
+
+			cell := ""
+
+			if value, ok := slotValue(slot, column); ok {
+				cell = strconv.FormatFloat(value, 'f', -1, 64)
+			}
+
+			row = append(row, cell)
+
+		}
+
+		rows = append(rows, row)
+
+	}
+
+	return rows
+
+}
+
+// getTemperaturesCSV serves the same 24 hourly slots as /temperatures as a
+// CSV download.
+func (s *Server) getTemperaturesCSV(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	site, ok := siteParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	sensor, ok := sensorParam(w, r)
+
+	if !ok {
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	slots, err := s.readTemperatures(ctx, site, sensor)
+
+	if err != nil {
+		slog.Error("read temperatures", "op", "getTemperaturesCSV", "collection", s.cfg.Collections.Temperatures, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("temperatures-%s-%s.csv", site, time.Now().In(s.cfg.Location).Format(rollupDateLayout))
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if err := csv.NewWriter(w).WriteAll(temperatureRows(slots)); err != nil {
+		slog.Error("write csv", "op", "getTemperaturesCSV", "err", err)
+	}
+
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMergeHourSlot(t *testing.T) {
+
+	hour := time.Date(2023, 4, 10, 14, 0, 0, 0, time.UTC)
+
+	first := mergeHourSlot(int64(0), hour, 24.5, 23)
+
+	if first["min_temperature"] != 23.0 || first["max_temperature"] != 23.0 {
+		t.Fatalf("first write: min/max = %v/%v, want 23/23", first["min_temperature"], first["max_temperature"])
+	}
+
+	second := mergeHourSlot(first, hour, 27, 26)
+
+	if second["adj_temperature"] != 26.0 || second["avg_temperature"] != 27.0 {
+		t.Errorf("second write: adj/avg = %v/%v, want 26/27", second["adj_temperature"], second["avg_temperature"])
+	}
+
+	if second["min_temperature"] != 23.0 || second["max_temperature"] != 26.0 {
+		t.Errorf("second write: min/max = %v/%v, want 23/26", second["min_temperature"], second["max_temperature"])
+	}
+
+	third := mergeHourSlot(second, hour, 21, 20)
+
+	if third["min_temperature"] != 20.0 || third["max_temperature"] != 26.0 {
+		t.Errorf("third write: min/max = %v/%v, want 20/26", third["min_temperature"], third["max_temperature"])
+	}
+
+	nextDay := mergeHourSlot(third, hour.Add(24*time.Hour), 25, 24)
+
+	if nextDay["min_temperature"] != 24.0 || nextDay["max_temperature"] != 24.0 {
+		t.Errorf("next day: min/max = %v/%v, want 24/24", nextDay["min_temperature"], nextDay["max_temperature"])
+	}
+
+}
+
+func TestStoredHours(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		want    int
+		wantErr bool
+	}{
+		{"missing field", map[string]interface{}{}, 0, false},
+		{"nil field", map[string]interface{}{"Temperatures": nil}, 0, false},
+		{"array", map[string]interface{}{"Temperatures": []interface{}{int64(0), int64(0)}}, 2, false},
+		{"wrong type", map[string]interface{}{"Temperatures": "oops"}, 0, true},
+	}
+
+	for _, tt := range tests {
+
+		hours, err := storedHours(tt.data)
+
+		if (err != nil) != tt.wantErr || len(hours) != tt.want {
+			t.Errorf("%s: storedHours() = %d slots, %v; want %d slots, error %v", tt.name, len(hours), err, tt.want, tt.wantErr)
+		}
+
+	}
+
+}
+
+func TestWriteTemperatureCreatesValues(t *testing.T) {
+
+	s := newTestServer(t)
+	ctx := context.Background()
+	values := s.collection("test-site", s.cfg.Collections.Temperatures).Doc("values")
+
+	for _, initial := range []map[string]interface{}{nil, {"other": true}} {
+
+		values.Delete(ctx)
+
+		if initial != nil {
+
+			if _, err := values.Set(ctx, initial); err != nil {
+				t.Fatal(err)
+			}
+
+		}
+
+		if _, err := s.writeTemperature(ctx, LogTemperature{SiteID: "test-site", AdjTemperature: 22, AvgTemperature: 23}); err != nil {
+			t.Fatalf("initial %v: writeTemperature() = %v", initial, err)
+		}
+
+		slots, err := s.readTemperatures(ctx, "test-site", defaultSensor)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hour := time.Now().In(s.cfg.Location).Hour()
+
+		if adj, ok := slotValue(slots[hour], "adj_temperature"); len(slots) != 24 || !ok || adj != 22 {
+			t.Errorf("initial %v: slots = %v, want 24 slots with 22 at hour %d", initial, slots, hour)
+		}
+
+	}
+
+}
+
+func TestWriteTemperatureConcurrent(t *testing.T) {
+
+	s := newTestServer(t)
+	ctx := context.Background()
+	values := s.collection("test-site", s.cfg.Collections.Temperatures).Doc("values")
+	values.Delete(ctx)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+
+	for i := 0; i < 10; i++ {
+
+		wg.Add(1)
+
+		go func(adj float64) {
+
+			defer wg.Done()
+			_, err := s.writeTemperature(ctx, LogTemperature{SiteID: "test-site", AdjTemperature: adj, AvgTemperature: adj})
+			errs <- err
+
+		}(float64(10 + i))
+
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+
+		if err != nil {
+			t.Fatalf("writeTemperature() = %v", err)
+		}
+
+	}
+
+	slots, err := s.readTemperatures(ctx, "test-site", defaultSensor)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every write must have been merged, so the hour spans all of them.
+	slot := slots[time.Now().In(s.cfg.Location).Hour()]
+	low, _ := slotValue(slot, "min_temperature")
+	high, _ := slotValue(slot, "max_temperature")
+
+	if low != 10 || high != 19 {
+		t.Errorf("min/max = %v/%v, want 10/19", low, high)
+	}
+
+}
+
+func TestEMA(t *testing.T) {
+
+	if got := ema(0, false, 25, 0.3); got != 25 {
+		t.Errorf("first value = %v, want 25", got)
+	}
+
+	if got := ema(20, true, 30, 0.5); got != 25 {
+		t.Errorf("ema(20, 30, 0.5) = %v, want 25", got)
+	}
+
+	// A step from 20 to 30 approaches 30 and never overshoots.
+	avg, prev := 20.0, 20.0
+
+	for i := 0; i < 50; i++ {
+
+		avg = ema(avg, true, 30, 0.2)
+
+		if avg < prev || avg > 30 {
+			t.Fatalf("step %d: ema = %v after %v, want monotonic towards 30", i, avg, prev)
+		}
+
+		prev = avg
+
+	}
+
+	if math.Abs(avg-30) > 0.01 {
+		t.Errorf("ema after 50 steps = %v, want ~30", avg)
+	}
+
+	// A single spike only moves the average by alpha of its size.
+	if got := ema(22, true, 42, 0.1); math.Abs(got-24) > 1e-9 {
+		t.Errorf("spike = %v, want 24", got)
+	}
+
+}
+
+func TestTemperatureRows(t *testing.T) {
+
+	slots := []interface{}{
+		map[string]interface{}{"avg_temperature": 4.5, "adj_temperature": int64(4), "min_temperature": 3.25, "max_temperature": 5.0},
+		nil,
+		map[string]interface{}{"avg_temperature": 6.0},
+	}
+
+	want := [][]string{
+		{"hour", "avg_temperature", "adj_temperature", "min_temperature", "max_temperature"},
+		{"0", "4.5", "4", "3.25", "5"},
+		{"1", "", "", "", ""},
+		{"2", "6", "", "", ""},
+	}
+
+	got := temperatureRows(slots)
+
+	if len(got) != len(want) {
+		t.Fatalf("%d rows, want %d", len(got), len(want))
+	}
+
+	for i := range want {
+
+		if strings.Join(got[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d = %v, want %v", i, got[i], want[i])
+		}
+
+	}
+
+}
+
+func TestRoundTo(t *testing.T) {
+
+	tests := []struct {
+		x        float64
+		decimals int
+		want     float64
+	}{
+		{23.456, 2, 23.46},
+		{23.454, 2, 23.45},
+		{-3.456, 2, -3.46},
+		{23.456, 1, 23.5},
+		{23.5, 0, 24},
+	}
+
+	for _, tt := range tests {
+
+		if got := roundTo(tt.x, tt.decimals); got != tt.want {
+			t.Errorf("roundTo(%v, %d) = %v, want %v", tt.x, tt.decimals, got, tt.want)
+		}
+
+	}
+
+}
+
+func TestIsSpike(t *testing.T) {
+
+	hour := time.Date(2023, 4, 10, 14, 0, 0, 0, time.UTC)
+	previous := map[string]interface{}{"adj_temperature": 4.0, "hour": hour.Add(-time.Hour)}
+	yesterday := map[string]interface{}{"adj_temperature": 4.0, "hour": hour.Add(-25 * time.Hour)}
+
+	tests := []struct {
+		name  string
+		prev  interface{}
+		adj   float64
+		delta float64
+		want  bool
+	}{
+		{"jump", previous, 44, 10, true},
+		{"drop", previous, -7, 10, true},
+		{"within delta", previous, 13.5, 10, false},
+		{"no previous value", nil, 44, 10, false},
+		{"stale previous slot", yesterday, 44, 10, false},
+		{"disabled", previous, 44, 0, false},
+	}
+
+	for _, tt := range tests {
+
+		if got := isSpike(tt.prev, hour, tt.adj, tt.delta); got != tt.want {
+			t.Errorf("%s: isSpike() = %v, want %v", tt.name, got, tt.want)
+		}
+
+	}
+
+}
+
+func TestCheckHourIndex(t *testing.T) {
+
+	if err := checkHourIndex(make([]interface{}, 24), 23); err != nil {
+		t.Errorf("24 slots, hour 23: %v", err)
+	}
+
+	if err := checkHourIndex(make([]interface{}, 23), 5); err == nil {
+		t.Error("23 slots accepted")
+	}
+
+	if err := checkHourIndex(make([]interface{}, 24), 24); err == nil {
+		t.Error("hour 24 accepted")
+	}
+
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/template"
+)
+
+// Template names looked up for the notification title and body.
+const (
+	titleTemplate = "title"
+	bodyTemplate  = "body"
+)
+
+// templateData is what the notification templates are executed with. The
+// embedded Ambient already carries the derived heat index and dew point.
+type templateData struct {
+	Ambient
+	Site  string
+	Alert string
+}
+
+// loadTemplates parses the notification templates, either the "title" and
+// "body" templates defined in NOTIFICATION_TEMPLATE_FILE or the
+// NOTIFICATION_TITLE_TEMPLATE and NOTIFICATION_BODY_TEMPLATE strings. It
+// returns nil when none is given. The temp function formats a °C value in
+// TEMP_UNIT.
+func loadTemplates(unit string) (*template.Template, error) {
+
+	funcs := template.FuncMap{
+		"temp": func(celsius float64) string { return formatTemperature(celsius, unit) },
+	}
+
+	root := template.New("notification").Funcs(funcs)
+
+	if path := os.Getenv("NOTIFICATION_TEMPLATE_FILE"); path != "" {
+
+		text, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid NOTIFICATION_TEMPLATE_FILE: %w", err)
+		}
+
+		if _, err = root.Parse(string(text)); err != nil {
+			return nil, fmt.Errorf("invalid NOTIFICATION_TEMPLATE_FILE: %w", err)
+		}
+
+		return root, nil
+
+	}
+
+	found := false
+
+	for name, key := range map[string]string{titleTemplate: "NOTIFICATION_TITLE_TEMPLATE", bodyTemplate: "NOTIFICATION_BODY_TEMPLATE"} {
+
+		text := os.Getenv(key)
+
+		if text == "" {
+			continue
+		}
+
+		if _, err := root.New(name).Parse(text); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+
+		found = true
+
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	return root, nil
+
+}
+
+// renderTemplate executes the named template, returning fallback when there
+// is no such template or it fails.
+func renderTemplate(templates *template.Template, name string, data templateData, fallback string) string {
+
+	if templates == nil || templates.Lookup(name) == nil {
+		return fallback
+	}
+
+	var out bytes.Buffer
+
+	if err := templates.ExecuteTemplate(&out, name, data); err != nil {
+		slog.Error("render notification template", "op", "renderTemplate", "template", name, "err", err)
+		return fallback
+	}
+
+	return out.String()
+
+}
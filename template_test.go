@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTemplatesFromEnv(t *testing.T) {
+
+	t.Setenv("NOTIFICATION_TEMPLATE_FILE", "")
+	t.Setenv("NOTIFICATION_TITLE_TEMPLATE", "{{.Site}} is at {{temp .Temperature}}")
+	t.Setenv("NOTIFICATION_BODY_TEMPLATE", "")
+
+	templates, err := loadTemplates("C")
+
+	if err != nil {
+		t.Fatalf("loadTemplates() error = %v", err)
+	}
+
+	s := &Server{cfg: Config{Locale: "en", TempUnit: "C", HumidityMax: 70, Templates: templates}}
+	title, body := s.alertText(Ambient{SiteID: "room-1", Temperature: 31, Humidity: 40, HeatIndex: 32, DewPoint: 16})
+
+	if title != "room-1 is at 31.00°C" {
+		t.Errorf("title = %q", title)
+	}
+
+	// Without a body template the catalog body is kept.
+	if want := ambientBody(Ambient{Temperature: 31, Humidity: 40, HeatIndex: 32, DewPoint: 16}, s.cfg, messages["en"]); body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+
+}
+
+func TestLoadTemplatesFromFile(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "notification.tmpl")
+	text := `{{define "title"}}[{{.Site}}] {{.Alert}}{{end}}{{define "body"}}HI {{printf "%.1f" .HeatIndex}} DP {{printf "%.1f" .DewPoint}}{{end}}`
+
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("NOTIFICATION_TEMPLATE_FILE", path)
+
+	templates, err := loadTemplates("C")
+
+	if err != nil {
+		t.Fatalf("loadTemplates() error = %v", err)
+	}
+
+	s := &Server{cfg: Config{Locale: "es", TempUnit: "C", Templates: templates}}
+	title, body := s.alertText(Ambient{SiteID: "room-1", Temperature: 31, Humidity: 40, HeatIndex: 32.25, DewPoint: 16.04})
+
+	if title != "[room-1] temperature" || body != "HI 32.2 DP 16.0" {
+		t.Errorf("alertText() = %q, %q", title, body)
+	}
+
+}
+
+func TestLoadTemplatesInvalid(t *testing.T) {
+
+	t.Setenv("NOTIFICATION_TEMPLATE_FILE", "")
+	t.Setenv("NOTIFICATION_BODY_TEMPLATE", "{{.Temperature")
+
+	if _, err := loadTemplates("C"); err == nil {
+		t.Error("loadTemplates() = nil error, want a parse error")
+	}
+
+}
+
+func TestLoadTemplatesNone(t *testing.T) {
+
+	t.Setenv("NOTIFICATION_TEMPLATE_FILE", "")
+	t.Setenv("NOTIFICATION_TITLE_TEMPLATE", "")
+	t.Setenv("NOTIFICATION_BODY_TEMPLATE", "")
+
+	if templates, err := loadTemplates("C"); templates != nil || err != nil {
+		t.Errorf("loadTemplates() = %v, %v; want nil, nil", templates, err)
+	}
+
+}
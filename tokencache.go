@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// cachedTokens is the last token list read for a site.
+type cachedTokens struct {
+	tokens  []string
+	refs    []*firestore.DocumentRef
+	fetched time.Time
+}
+
+// tokenCache keeps the last token list read successfully for each site, so
+// broadcast can still alert when a read fails during a Firestore outage.
+// Entries older than maxAge aren't used. A nil cache keeps nothing.
+type tokenCache struct {
+	maxAge time.Duration
+
+	mu    sync.Mutex
+	sites map[string]cachedTokens
+}
+
+func newTokenCache(maxAge time.Duration) *tokenCache {
+
+	return &tokenCache{maxAge: maxAge, sites: map[string]cachedTokens{}}
+
+}
+
+// store replaces the site's cached list with a freshly read one.
+func (c *tokenCache) store(site string, tokens []string, refs []*firestore.DocumentRef, now time.Time) {
+
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sites[site] = cachedTokens{tokens: tokens, refs: refs, fetched: now}
+
+}
+
+// load returns the site's cached list and its age, if it is recent enough.
+func (c *tokenCache) load(site string, now time.Time) (tokens []string, refs []*firestore.DocumentRef, age time.Duration, ok bool) {
+
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.sites[site]
+	age = now.Sub(cached.fetched)
+
+	if !ok || age > c.maxAge {
+		return nil, nil, 0, false
+	}
+
+	return cached.tokens, cached.refs, age, true
+
+}
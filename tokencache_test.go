@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+func TestTokenCache(t *testing.T) {
+
+	c := newTokenCache(time.Hour)
+	now := time.Now()
+
+	if _, _, _, ok := c.load("room-1", now); ok {
+		t.Fatal("load() hit on an empty cache")
+	}
+
+	c.store("room-1", []string{"a", "b"}, make([]*firestore.DocumentRef, 2), now)
+
+	if tokens, _, age, ok := c.load("room-1", now.Add(10*time.Minute)); !ok || len(tokens) != 2 || age != 10*time.Minute {
+		t.Errorf("load() = %v, %v, %v; want both tokens 10m old", tokens, age, ok)
+	}
+
+	if _, _, _, ok := c.load("room-1", now.Add(2*time.Hour)); ok {
+		t.Error("load() used an entry past maxAge")
+	}
+
+	c.store("room-1", []string{"c"}, make([]*firestore.DocumentRef, 1), now.Add(2*time.Hour))
+
+	if tokens, _, _, ok := c.load("room-1", now.Add(2*time.Hour)); !ok || len(tokens) != 1 || tokens[0] != "c" {
+		t.Errorf("load() after a fresh read = %v, want it replaced", tokens)
+	}
+
+	var disabled *tokenCache
+	disabled.store("room-1", []string{"a"}, nil, now)
+
+	if _, _, _, ok := disabled.load("room-1", now); ok {
+		t.Error("nil cache returned tokens")
+	}
+
+}
+
+func TestBroadcastCachedTokens(t *testing.T) {
+
+	// Nothing listens on the port, so every token read fails.
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "127.0.0.1:1")
+
+	fs, err := firestore.NewClient(context.Background(), emulatorProjectID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { fs.Close() })
+
+	fcm := &fakeNotifier{}
+	s := &Server{
+		cfg:        Config{FirestoreAttempts: 1, Collections: loadCollections()},
+		fs:         fs,
+		fcm:        fcm,
+		tokenCache: newTokenCache(time.Hour),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := s.broadcast(ctx, "room-1", alertTemperature, map[string]string{"Title": "t"}); err == nil {
+		t.Fatal("broadcast() without cached tokens succeeded")
+	}
+
+	s.tokenCache.store("room-1", []string{"cached-1", "cached-2"}, make([]*firestore.DocumentRef, 2), time.Now())
+
+	result, err := s.broadcast(ctx, "room-1", alertTemperature, map[string]string{"Title": "t"})
+
+	if err != nil || result.Sent != 2 || len(fcm.multicasts) != 1 {
+		t.Errorf("broadcast() = %+v, %v with %d multicasts; want the cached tokens used", result, err, len(fcm.multicasts))
+	}
+
+}
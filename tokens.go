@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// bulkTokenChunk is the most tokens looked up and written per Firestore
+// batch, the batch write limit.
+const bulkTokenChunk = 500
+
+// bulkTokenMaxBytes bounds a /tokens/bulk body. It is well past MaxBodyBytes
+// so a whole user base can be loaded in one request.
+const bulkTokenMaxBytes = 8 << 20
+
+// TokenRequest is the body of /tokens. SiteID is only required when tokens
+// are scoped per site.
+type TokenRequest struct {
+	Token  string `json:"token"`
+	SiteID string `json:"siteId"`
+}
+
+// tokens registers (POST) or unregisters (DELETE) a device token. Tokens are
+// stored using the token itself as the document ID so registering twice
+// simply overwrites the same document.
+func (s *Server) tokens(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "POST" && r.Method != "DELETE" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	req := TokenRequest{}
+
+	if err := s.decodeJSON(w, r, &req); err != nil {
+
+		slog.Error("decode token", "op", "tokens", "err", err)
+
+		if isTooLarge(err) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write([]byte("Body too large"))
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Missing token"))
+		return
+
+	}
+
+	token := strings.TrimSpace(req.Token)
+
+	if token == "" || strings.Contains(token, "/") {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Invalid token"))
+		return
+	}
+
+	if s.cfg.TokensPerSite {
+
+		if err := validSiteID(req.SiteID); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	doc := s.tokenCollection(req.SiteID).Doc(token)
+	var err error
+
+	if r.Method == "POST" {
+		_, err = doc.Set(ctx, map[string]interface{}{"token": token})
+	} else {
+		_, err = doc.Delete(ctx)
+	}
+
+	if err != nil {
+		slog.Error("write token", "op", "tokens", "method", r.Method, "collection", s.cfg.Collections.Tokens, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Fail in writing token"))
+		return
+	}
+
+}
+
+// BulkTokenResult is the answer of /tokens/bulk. Skipped counts tokens that
+// were already registered or repeated in the request.
+type BulkTokenResult struct {
+	Added   int `json:"added"`
+	Skipped int `json:"skipped"`
+}
+
+// bulkTokens upserts a JSON array of token strings, for migrating an
+// existing user base. Tokens are scoped to ?site= when tokens are stored per
+// site. Tokens already registered are left alone. When a chunk fails the
+// answer is a 500 with the counts of the chunks committed before it, so the
+// import can be resumed by sending the same body again.
+func (s *Server) bulkTokens(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Invalid Method"))
+		return
+	}
+
+	site := ""
+
+	if s.cfg.TokensPerSite {
+
+		var ok bool
+
+		if site, ok = siteParam(w, r); !ok {
+			return
+		}
+
+	}
+
+	var entries []interface{}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, bulkTokenMaxBytes)).Decode(&entries); err != nil {
+
+		slog.Error("decode tokens", "op", "bulkTokens", "err", err)
+
+		if isTooLarge(err) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write([]byte("Body too large"))
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Body must be a JSON array of tokens"))
+		return
+
+	}
+
+	tokens, repeated, err := parseBulkTokens(entries)
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	result := BulkTokenResult{Skipped: repeated}
+	collection := s.tokenCollection(site)
+
+	for start := 0; start < len(tokens); start += bulkTokenChunk {
+
+		end := min(start+bulkTokenChunk, len(tokens))
+		added, err := s.importTokens(ctx, collection, tokens[start:end])
+
+		if err != nil {
+			slog.Error("import tokens", "op", "bulkTokens", "collection", s.cfg.Collections.Tokens, "added", result.Added, "err", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+
+		result.Added += added
+		result.Skipped += end - start - added
+
+	}
+
+	slog.Info("imported tokens", "site", site, "added", result.Added, "skipped", result.Skipped)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+
+}
+
+// parseBulkTokens validates the entries of a /tokens/bulk body and returns
+// the distinct tokens, in order, and how many entries repeated one.
+func parseBulkTokens(entries []interface{}) (tokens []string, repeated int, err error) {
+
+	seen := map[string]bool{}
+
+	for i, entry := range entries {
+
+		token, ok := entry.(string)
+		token = strings.TrimSpace(token)
+
+		if !ok || token == "" || strings.Contains(token, "/") {
+			return nil, 0, fmt.Errorf("entry %d: invalid token", i)
+		}
+
+		if seen[token] {
+			repeated++
+			continue
+		}
+
+		seen[token] = true
+		tokens = append(tokens, token)
+
+	}
+
+	return
+
+}
+
+// importTokens writes the tokens that aren't registered yet in one batch and
+// returns how many it wrote. The chunk is bounded by FirestoreTimeout.
+func (s *Server) importTokens(ctx context.Context, collection *firestore.CollectionRef, tokens []string) (added int, err error) {
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.FirestoreTimeout)
+	defer cancel()
+
+	defer observeFirestore("bulkTokens", time.Now())
+
+	refs := make([]*firestore.DocumentRef, len(tokens))
+
+	for i, token := range tokens {
+		refs[i] = collection.Doc(token)
+	}
+
+	var docs []*firestore.DocumentSnapshot
+
+	err = s.retry(ctx, func() (err error) {
+		docs, err = s.fs.GetAll(ctx, refs)
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	batch := s.fs.Batch()
+
+	for i, doc := range docs {
+
+		if doc.Exists() {
+			continue
+		}
+
+		batch.Set(refs[i], map[string]interface{}{"token": tokens[i]})
+		added++
+
+	}
+
+	if added == 0 {
+		return
+	}
+
+	err = s.retry(ctx, func() (err error) {
+		_, err = batch.Commit(ctx)
+		return
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return
+
+}
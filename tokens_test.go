@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+func TestParseBulkTokens(t *testing.T) {
+
+	tokens, repeated, err := parseBulkTokens([]interface{}{"a", " b ", "a", "c", "b"})
+
+	if err != nil || strings.Join(tokens, ",") != "a,b,c" || repeated != 2 {
+		t.Errorf("parseBulkTokens() = %v, %d, %v; want [a b c], 2 repeated", tokens, repeated, err)
+	}
+
+	for _, entries := range [][]interface{}{{"a", ""}, {"a", 42.0}, {"a/b"}, {nil}} {
+
+		if _, _, err := parseBulkTokens(entries); err == nil {
+			t.Errorf("parseBulkTokens(%v) accepted an invalid entry", entries)
+		}
+
+	}
+
+}
+
+func TestBulkTokensInvalid(t *testing.T) {
+
+	s := &Server{}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"method", "GET", ``, http.StatusMethodNotAllowed},
+		{"not an array", "POST", `{"token":"a"}`, http.StatusBadRequest},
+		{"empty entry", "POST", `["a",""]`, http.StatusBadRequest},
+		{"not a string", "POST", `["a",{}]`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+
+		w := httptest.NewRecorder()
+		s.bulkTokens(w, httptest.NewRequest(tt.method, "/tokens/bulk", strings.NewReader(tt.body)))
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+
+	}
+
+}
+
+func TestBulkTokensFailed(t *testing.T) {
+
+	// Nothing listens on the port, so every chunk fails.
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "127.0.0.1:1")
+
+	fs, err := firestore.NewClient(context.Background(), emulatorProjectID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { fs.Close() })
+
+	s := &Server{
+		cfg: Config{FirestoreAttempts: 1, FirestoreTimeout: 5 * time.Second, Collections: loadCollections()},
+		fs:  fs,
+	}
+
+	w := httptest.NewRecorder()
+	s.bulkTokens(w, httptest.NewRequest("POST", "/tokens/bulk", strings.NewReader(`["a", "b", "a"]`)))
+
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got %d %q, want a JSON 500", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	var result BulkTokenResult
+
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil || result.Added != 0 || result.Skipped != 1 {
+		t.Errorf("result = %+v, %v; want nothing added and the repeat skipped", result, err)
+	}
+
+}
+
+func TestBulkTokens(t *testing.T) {
+
+	s := newTestServer(t)
+	collection := s.tokenCollection("")
+	clearCollection(t, collection)
+	t.Cleanup(func() { clearCollection(t, collection) })
+
+	if _, err := collection.Doc("existing").Set(context.Background(), map[string]interface{}{"token": "existing"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := []string{"existing", "existing"}
+
+	for i := 0; i < bulkTokenChunk+10; i++ {
+		tokens = append(tokens, fmt.Sprintf("token-%d", i))
+	}
+
+	body, _ := json.Marshal(tokens)
+	w := httptest.NewRecorder()
+	s.bulkTokens(w, httptest.NewRequest("POST", "/tokens/bulk", strings.NewReader(string(body))))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s), want 200", w.Code, w.Body.String())
+	}
+
+	var result BulkTokenResult
+
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Added != bulkTokenChunk+10 || result.Skipped != 2 {
+		t.Errorf("result = %+v, want %d added and 2 skipped", result, bulkTokenChunk+10)
+	}
+
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const alertRising = "rising"
+
+// riseRate returns how fast the adjusted temperature climbed since the last
+// reading, in °C per minute. Readings less than a minute apart are treated
+// as a minute apart, so a quick resend can't turn a small step into a steep
+// rate.
+func riseRate(last float64, lastAt time.Time, adj float64, now time.Time) float64 {
+
+	minutes := now.Sub(lastAt).Minutes()
+
+	if minutes < 1 {
+		minutes = 1
+	}
+
+	return (adj - last) / minutes
+
+}
+
+// formatRate renders a rate of change in °C per minute in the configured
+// unit.
+func formatRate(rate float64, unit string) string {
+
+	if unit == "F" {
+		return fmt.Sprintf("%.2f°F", rate*9/5)
+	}
+
+	return fmt.Sprintf("%.2f°C", rate)
+
+}
+
+// notifyRising sends the "temperature rising rapidly" alert for a reading
+// that climbed faster than TempRiseRate. It is sent whether or not the
+// reading is past the thresholds, and a failed delivery is only logged.
+func (s *Server) notifyRising(ctx context.Context, temp LogTemperature, rate float64) {
+
+	now := time.Now()
+	key := alertKey(sourceName(temp.SiteID, temp.SensorID), alertRising)
+
+	if s.inCooldown(key, now) {
+		return
+	}
+
+	msgs := messages[s.cfg.Locale]
+	adj := roundTo(temp.AdjTemperature, s.cfg.TempDecimals)
+
+	_, err := s.broadcast(ctx, temp.SiteID, alertRising, map[string]string{
+		"Title":    siteTitle(sourceName(temp.SiteID, temp.SensorID), msgs.RisingTitle),
+		"Body":     fmt.Sprintf(msgs.RisingBody, formatRate(rate, s.cfg.TempUnit), formatTemperature(adj, s.cfg.TempUnit)),
+		"Site":     temp.SiteID,
+		"Severity": severityCritical,
+		"type":     typeRising,
+	})
+
+	if err != nil {
+		slog.Error("send rising alert", "op", "setTemperatures", "site", temp.SiteID, "rate", rate, "err", err)
+		return
+	}
+
+	s.markSent(key, now)
+
+}
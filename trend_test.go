@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRiseRate(t *testing.T) {
+
+	now := time.Date(2023, 4, 10, 14, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		last   float64
+		lastAt time.Time
+		adj    float64
+		want   float64
+	}{
+		{"rising", 20, now.Add(-5 * time.Minute), 25, 1},
+		{"falling", 25, now.Add(-10 * time.Minute), 20, -0.5},
+		{"steady", 22, now.Add(-time.Hour), 22, 0},
+		{"within a minute", 20, now.Add(-10 * time.Second), 21, 1},
+		{"clock skew", 20, now.Add(time.Minute), 22, 2},
+	}
+
+	for _, tt := range tests {
+
+		if got := riseRate(tt.last, tt.lastAt, tt.adj, now); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: riseRate() = %v, want %v", tt.name, got, tt.want)
+		}
+
+	}
+
+}
+
+func TestFormatRate(t *testing.T) {
+
+	if got := formatRate(0.5, "C"); got != "0.50°C" {
+		t.Errorf("formatRate(0.5, C) = %q", got)
+	}
+
+	if got := formatRate(0.5, "F"); got != "0.90°F" {
+		t.Errorf("formatRate(0.5, F) = %q", got)
+	}
+
+}
+
+func TestNotifyRising(t *testing.T) {
+
+	fcm := &fakeNotifier{}
+	s := &Server{
+		cfg: Config{
+			Cooldown:  time.Minute,
+			TempUnit:  "C",
+			Locale:    "en",
+			UseTopic:  true,
+			TopicName: "alerts",
+		},
+		fcm:      fcm,
+		lastSent: map[string]time.Time{},
+	}
+
+	temp := LogTemperature{SiteID: "room-1", SensorID: "rack-2", AdjTemperature: 27}
+
+	s.notifyRising(context.Background(), temp, 1.5)
+	s.notifyRising(context.Background(), temp, 2)
+
+	if len(fcm.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1 and the second in cooldown", len(fcm.sent))
+	}
+
+	data := fcm.sent[0].Data
+
+	if data["type"] != typeRising || data["Severity"] != severityCritical {
+		t.Errorf("data = %v, want a critical %s alert", data, typeRising)
+	}
+
+	if !strings.HasPrefix(data["Title"], "[room-1/rack-2] ") || !strings.Contains(data["Body"], "1.50°C") {
+		t.Errorf("title = %q, body = %q", data["Title"], data["Body"])
+	}
+
+	// Another sensor at the same site has its own cooldown.
+	s.notifyRising(context.Background(), LogTemperature{SiteID: "room-1", AdjTemperature: 27}, 1.5)
+
+	if len(fcm.sent) != 2 {
+		t.Errorf("sent %d messages, want the default sensor's alert too", len(fcm.sent))
+	}
+
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetVersion(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	getVersion(w, httptest.NewRequest("GET", "/version", nil))
+
+	var got map[string]string
+
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusOK || got["version"] != "dev" || got["commit"] != "unknown" || got["buildTime"] != "unknown" {
+		t.Errorf("got %d %v, want the dev defaults", w.Code, got)
+	}
+
+	w = httptest.NewRecorder()
+	getVersion(w, httptest.NewRequest("POST", "/version", nil))
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", w.Code)
+	}
+
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// AlertPayload is the JSON body POSTed to WEBHOOK_URL for every alert.
+type AlertPayload struct {
+	Type        string    `json:"type"`
+	SiteID      string    `json:"siteId"`
+	SensorID    string    `json:"sensorId"`
+	Temperature float64   `json:"temperature"`
+	Humidity    float64   `json:"humidity"`
+	HeatIndex   float64   `json:"heatIndex"`
+	DewPoint    float64   `json:"dewPoint"`
+	Movement    int       `json:"move"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// notifyWebhook posts the alert to WEBHOOK_URL when one is configured and
+// reports whether it was delivered. It runs whether or not the push went
+// out, and a failed delivery is only logged.
+func (s *Server) notifyWebhook(ctx context.Context, alert string, ambient Ambient) (delivered bool) {
+
+	if s.cfg.WebhookURL == "" {
+		return
+	}
+
+	payload := AlertPayload{
+		Type:        alert,
+		SiteID:      ambient.SiteID,
+		SensorID:    ambient.SensorID,
+		Temperature: ambient.Temperature,
+		Humidity:    ambient.Humidity,
+		HeatIndex:   ambient.HeatIndex,
+		DewPoint:    ambient.DewPoint,
+		Movement:    ambient.Movement,
+		Timestamp:   time.Now().In(s.cfg.Location),
+	}
+
+	if err := s.postWebhook(ctx, payload); err != nil {
+		slog.Error("post webhook", "op", "notifyWebhook", "site", ambient.SiteID, "alert", alert, "err", err)
+		return
+	}
+
+	return true
+
+}
+
+func (s *Server) postWebhook(ctx context.Context, payload AlertPayload) error {
+
+	return s.postJSON(ctx, s.cfg.WebhookURL, payload)
+
+}
+
+// postJSON POSTs payload as JSON to url within WebhookTimeout. The push may
+// already have used up the request's deadline, so only ctx's values are kept.
+func (s *Server) postJSON(ctx context.Context, url string, payload interface{}) error {
+
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.cfg.WebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+
+	return nil
+
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendPushNotificationWebhook(t *testing.T) {
+
+	payloads := make(chan AlertPayload, 1)
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var payload AlertPayload
+
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("webhook got %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode webhook body: %v", err)
+		}
+
+		payloads <- payload
+
+		// A failing webhook must not fail the alert.
+		w.WriteHeader(http.StatusInternalServerError)
+
+	}))
+	defer hook.Close()
+
+	fcm := &fakeNotifier{}
+	s := &Server{
+		cfg: Config{
+			TempMax:        30,
+			HeatIndexMax:   40,
+			HumidityMax:    70,
+			Cooldown:       time.Minute,
+			Location:       defaultTimeZone,
+			TempUnit:       "C",
+			Locale:         "es",
+			UseTopic:       true,
+			TopicName:      "alerts",
+			WebhookURL:     hook.URL,
+			WebhookTimeout: time.Second,
+		},
+		fcm:      fcm,
+		lastSent: map[string]time.Time{},
+	}
+
+	ambient := Ambient{SiteID: "room-1", Temperature: 35, Humidity: 40, HeatIndex: 36}
+	result, err := s.sendPushNotification(context.Background(), ambient)
+
+	if err != nil || result.Sent != 1 {
+		t.Fatalf("sendPushNotification() = %+v, %v; want 1 sent", result, err)
+	}
+
+	if data := fcm.sent[0].Data; data["type"] != typeAmbient || data["channel"] != severityCritical || len(data) != 6 {
+		t.Errorf("data = %v, want the five contract keys with type %q and the channel", data, typeAmbient)
+	}
+
+	select {
+
+	case payload := <-payloads:
+
+		if payload.Type != alertTemperature || payload.SiteID != "room-1" || payload.Temperature != 35 || payload.Timestamp.IsZero() {
+			t.Errorf("payload = %+v", payload)
+		}
+
+	default:
+		t.Fatal("webhook was not called")
+
+	}
+
+}
+
+func TestSendPushNotificationWebhookPushFailed(t *testing.T) {
+
+	calls := make(chan struct{}, 2)
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls <- struct{}{}
+	}))
+	defer hook.Close()
+
+	fcm := &fakeNotifier{err: errors.New("fcm down")}
+	s := &Server{
+		cfg: Config{
+			TempMax:        30,
+			HeatIndexMax:   40,
+			HumidityMax:    70,
+			Cooldown:       time.Minute,
+			Location:       defaultTimeZone,
+			TempUnit:       "C",
+			Locale:         "es",
+			UseTopic:       true,
+			TopicName:      "alerts",
+			WebhookURL:     hook.URL,
+			WebhookTimeout: time.Second,
+		},
+		fcm:      fcm,
+		lastSent: map[string]time.Time{},
+	}
+
+	ambient := Ambient{SiteID: "room-1", Temperature: 35, Humidity: 40, HeatIndex: 36}
+
+	if _, err := s.sendPushNotification(context.Background(), ambient); err == nil {
+		t.Fatal("sendPushNotification() = nil, want the push error")
+	}
+
+	// The webhook delivered, so the next reading is in cooldown rather than
+	// posting it again.
+	if _, err := s.sendPushNotification(context.Background(), ambient); !errors.Is(err, errCooldown) {
+		t.Errorf("second sendPushNotification() = %v, want %v", err, errCooldown)
+	}
+
+	if len(calls) != 1 || len(fcm.sent) != 1 {
+		t.Errorf("webhook called %d times and %d pushes tried, want 1 each", len(calls), len(fcm.sent))
+	}
+
+}
+
+func TestNotifyChannelsConcurrent(t *testing.T) {
+
+	release := make(chan struct{})
+
+	hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hang.Close()
+	defer close(release)
+
+	s := &Server{cfg: Config{
+		Location:        defaultTimeZone,
+		WebhookURL:      hang.URL,
+		SlackWebhookURL: hang.URL,
+		WebhookTimeout:  200 * time.Millisecond,
+	}}
+
+	// A cancelled request doesn't cut the channels short.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+
+	if s.notifyChannels(ctx, alertTemperature, Ambient{SiteID: "room-1", Temperature: 35}) {
+		t.Error("notifyChannels() = true, want nothing delivered")
+	}
+
+	// Both channels time out together rather than one after the other.
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed >= 400*time.Millisecond {
+		t.Errorf("notifyChannels() took %v, want one WebhookTimeout", elapsed)
+	}
+
+}
+
+func TestPostWebhookTimeout(t *testing.T) {
+
+	release := make(chan struct{})
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hook.Close()
+	defer close(release)
+
+	s := &Server{cfg: Config{WebhookURL: hook.URL, WebhookTimeout: 50 * time.Millisecond}}
+
+	if err := s.postWebhook(context.Background(), AlertPayload{Type: alertMovement}); err == nil {
+		t.Error("postWebhook() = nil, want a timeout error")
+	}
+
+}